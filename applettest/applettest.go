@@ -0,0 +1,310 @@
+// Package applettest runs applet RPC procedures in tests through the same
+// decoding, permission checks and error mapping as the real endpoint:
+//
+//	h := applettest.New(t, router, applettest.WithUser(applettest.NewUser(1, "chat.read")))
+//	res, err := applettest.Call[SendParams, SendResult](h, "chat.send", SendParams{Text: "hi"})
+//	applettest.RequireErrorCode(t, err, "forbidden")
+package applettest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets"
+	"github.com/iota-uz/applets/internal/controller"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
+)
+
+// Harness serves a router's procedures in process. It implements
+// http.Handler, so it can also back an httptest.Server.
+type Harness struct {
+	controller *controller.Controller
+	host       *Host
+	user       applets.AppletUser
+	ctx        context.Context
+	nextID     *atomic.Int64
+}
+
+type settings struct {
+	host    *Host
+	rpc     []func(*applets.RPCConfig)
+	builder []applets.BuilderOption
+	logger  *logrus.Logger
+	dev     bool
+}
+
+// Option configures a Harness.
+type Option func(*settings)
+
+// WithUser sets the user calls are made as. Without it calls have no user
+// and fail like unauthenticated requests.
+func WithUser(user applets.AppletUser) Option {
+	return func(s *settings) { s.host.User = user }
+}
+
+// WithTenantID sets the tenant returned by the fake host.
+func WithTenantID(id uuid.UUID) Option {
+	return func(s *settings) { s.host.TenantID = id }
+}
+
+// WithLocale sets the page locale returned by the fake host.
+func WithLocale(tag language.Tag) Option {
+	return func(s *settings) { s.host.Locale = tag }
+}
+
+// WithRPCConfig adjusts the RPC config built from the router, e.g. to set a
+// RateLimiter or Timeout.
+func WithRPCConfig(fn func(cfg *applets.RPCConfig)) Option {
+	return func(s *settings) { s.rpc = append(s.rpc, fn) }
+}
+
+// WithBuilderOptions passes options such as WithAuditSink to the controller.
+func WithBuilderOptions(opts ...applets.BuilderOption) Option {
+	return func(s *settings) { s.builder = append(s.builder, opts...) }
+}
+
+// WithDevMode runs the applet with the dev proxy enabled, as during local
+// development. Dev-only features such as RPCConfig.Replayer and
+// RPCIntrospectionConfig.Dev only take effect with it; by default the harness
+// runs like production.
+func WithDevMode() Option {
+	return func(s *settings) { s.dev = true }
+}
+
+// WithLogger sets the controller's logger. By default logs are discarded.
+func WithLogger(logger *logrus.Logger) Option {
+	return func(s *settings) { s.logger = logger }
+}
+
+type testApplet struct {
+	config applets.Config
+}
+
+func (a *testApplet) Name() string           { return "applettest" }
+func (a *testApplet) BasePath() string       { return "/applettest" }
+func (a *testApplet) Config() applets.Config { return a.config }
+
+// New returns a harness serving router. Internal errors are exposed in
+// responses so failures are easy to read; override it with WithRPCConfig.
+func New(t testing.TB, router *applets.TypedRPCRouter, opts ...Option) *Harness {
+	t.Helper()
+	s := settings{host: &Host{}}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if s.logger == nil {
+		s.logger = logrus.New()
+		s.logger.SetOutput(io.Discard)
+	}
+	rpcCfg := router.Config()
+	expose := true
+	rpcCfg.ExposeInternalErrors = &expose
+	for _, fn := range s.rpc {
+		fn(rpcCfg)
+	}
+	assets := applets.AssetConfig{
+		FS:           fstest.MapFS{"manifest.json": {Data: []byte(`{"index.html":{"file":"index.js","isEntry":true}}`)}},
+		ManifestPath: "manifest.json",
+		Entrypoint:   "index.html",
+	}
+	if s.dev {
+		assets = applets.AssetConfig{Dev: &applets.DevAssetConfig{Enabled: true, TargetURL: "http://localhost"}}
+	}
+	a := &testApplet{config: applets.Config{
+		WindowGlobal: "__APPLETTEST__",
+		Shell:        applets.ShellConfig{Mode: applets.ShellModeStandalone},
+		Assets:       assets,
+		RPC:          rpcCfg,
+	}}
+	c, err := controller.New(a, nil, applets.DefaultSessionConfig, s.logger, nil, s.host, s.builder...)
+	if err != nil {
+		t.Fatalf("applettest: %v", err)
+	}
+	return &Harness{controller: c, host: s.host, user: s.host.User, ctx: context.Background(), nextID: new(atomic.Int64)}
+}
+
+// As returns a harness sharing h's controller that calls as user. A nil user
+// calls without a user.
+func (h *Harness) As(user applets.AppletUser) *Harness {
+	clone := *h
+	clone.user = user
+	return &clone
+}
+
+// WithContext returns a harness sharing h's controller whose requests use ctx.
+func (h *Harness) WithContext(ctx context.Context) *Harness {
+	clone := *h
+	clone.ctx = ctx
+	return &clone
+}
+
+// Host returns the fake host, e.g. to change the tenant between calls.
+func (h *Harness) Host() *Host {
+	return h.host
+}
+
+// ServeHTTP serves r as the RPC endpoint, as the harness's user.
+func (h *Harness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), userKey{}, userValue{user: h.user})
+	h.controller.ServeRPC(w, r.WithContext(ctx))
+}
+
+// Error is an error response of a call.
+type Error struct {
+	Code    string
+	Message string
+	Details json.RawMessage
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+type errorEnvelope struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details"`
+}
+
+type response struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *errorEnvelope  `json:"error"`
+}
+
+func (h *Harness) post(method string, params any) (*httptest.ResponseRecorder, error) {
+	body, err := json.Marshal(map[string]any{
+		"id":     strconv.FormatInt(h.nextID.Add(1), 10),
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("applettest: encode params: %w", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(body)).WithContext(h.ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, nil
+}
+
+func decodeResponse[R any](data []byte) (R, error) {
+	var zero R
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return zero, fmt.Errorf("applettest: decode response %q: %w", data, err)
+	}
+	if resp.Error != nil {
+		return zero, &Error{Code: resp.Error.Code, Message: resp.Error.Message, Details: resp.Error.Details}
+	}
+	var res R
+	if len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, &res); err != nil {
+			return zero, fmt.Errorf("applettest: decode result: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// Call calls method with params and decodes its result. An error response is
+// returned as *Error.
+func Call[P any, R any](h *Harness, method string, params P) (R, error) {
+	w, err := h.post(method, params)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return decodeResponse[R](w.Body.Bytes())
+}
+
+// Stream calls a streaming method and returns the events it emitted. If the
+// stream ends with an error, the events before it are returned with an *Error.
+func Stream[P any, E any](h *Harness, method string, params P) ([]E, error) {
+	w, err := h.post(method, params)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		_, err := decodeResponse[json.RawMessage](w.Body.Bytes())
+		if err == nil {
+			err = fmt.Errorf("applettest: %s is not a streaming method", method)
+		}
+		return nil, err
+	}
+	var events []E
+	var event string
+	scanner := bufio.NewScanner(w.Body)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := []byte(strings.TrimPrefix(line, "data: "))
+			switch event {
+			case "result":
+				var e E
+				if err := json.Unmarshal(data, &e); err != nil {
+					return events, fmt.Errorf("applettest: decode event: %w", err)
+				}
+				events = append(events, e)
+			case "error":
+				var env errorEnvelope
+				if err := json.Unmarshal(data, &env); err != nil {
+					return events, fmt.Errorf("applettest: decode error event: %w", err)
+				}
+				return events, &Error{Code: env.Code, Message: env.Message, Details: env.Details}
+			case "done":
+				return events, nil
+			}
+		}
+	}
+	return events, errors.New("applettest: stream ended without done event")
+}
+
+// ErrorCode returns the code of an *Error, or "" for any other error.
+func ErrorCode(err error) string {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	return ""
+}
+
+// AssertErrorCode reports a test error unless err is an *Error with code.
+func AssertErrorCode(t testing.TB, err error, code string) bool {
+	t.Helper()
+	if got := ErrorCode(err); got != code {
+		t.Errorf("applettest: want error code %q, got %v", code, describeErr(err))
+		return false
+	}
+	return true
+}
+
+// RequireErrorCode is AssertErrorCode that stops the test on failure.
+func RequireErrorCode(t testing.TB, err error, code string) {
+	t.Helper()
+	if !AssertErrorCode(t, err, code) {
+		t.FailNow()
+	}
+}
+
+func describeErr(err error) string {
+	if err == nil {
+		return "no error"
+	}
+	return fmt.Sprintf("%q", err.Error())
+}
@@ -0,0 +1,119 @@
+package applettest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets"
+	"github.com/iota-uz/applets/applettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type greetParams struct {
+	Name string `json:"name"`
+}
+
+type greetResult struct {
+	Greeting string `json:"greeting"`
+	Tenant   string `json:"tenant"`
+	UserID   uint   `json:"userId"`
+}
+
+type tenantKey struct{}
+
+func newRouter(t *testing.T) *applets.TypedRPCRouter {
+	t.Helper()
+	r := applets.NewTypedRPCRouter()
+	notFound, err := applets.RegisterErrorCode[struct{}](r, "unknown_name", "name is unknown")
+	require.NoError(t, err)
+	require.NoError(t, applets.AddProcedure(r, "greet", applets.Procedure[greetParams, greetResult]{
+		RequirePermissions: []string{"greet"},
+		Errors:             []string{"unknown_name"},
+		Handler: func(ctx context.Context, p greetParams) (greetResult, error) {
+			if p.Name == "" {
+				return greetResult{}, notFound.New(struct{}{})
+			}
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			res := greetResult{Greeting: "hello " + p.Name, Tenant: tenant}
+			if u, ok := applets.UserFrom(ctx); ok {
+				res.UserID = u.ID()
+			}
+			return res, nil
+		},
+	}))
+	require.NoError(t, applets.AddStreamProcedure(r, "count", applets.StreamProcedure[struct{}, int]{
+		Handler: func(ctx context.Context, _ struct{}, emit applets.StreamEmitter[int]) error {
+			for i := 1; i <= 3; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("count: %w", applets.ErrNotFound)
+		},
+	}))
+	return r
+}
+
+func TestCall(t *testing.T) {
+	t.Parallel()
+
+	h := applettest.New(t, newRouter(t), applettest.WithUser(applettest.NewUser(1, "greet")), applettest.WithTenantID(uuid.New()))
+
+	res, err := applettest.Call[greetParams, greetResult](h.WithContext(context.WithValue(context.Background(), tenantKey{}, "acme")), "greet", greetParams{Name: "ada"})
+	require.NoError(t, err)
+	assert.Equal(t, greetResult{Greeting: "hello ada", Tenant: "acme", UserID: 1}, res)
+
+	_, err = applettest.Call[greetParams, greetResult](h, "greet", greetParams{})
+	applettest.RequireErrorCode(t, err, "unknown_name")
+
+	_, err = applettest.Call[greetParams, greetResult](h.As(applettest.NewUser(2)), "greet", greetParams{Name: "ada"})
+	applettest.RequireErrorCode(t, err, "forbidden")
+
+	_, err = applettest.Call[greetParams, greetResult](h.As(nil), "greet", greetParams{Name: "ada"})
+	applettest.RequireErrorCode(t, err, "forbidden")
+
+	_, err = applettest.Call[greetParams, greetResult](h, "missing", greetParams{})
+	applettest.RequireErrorCode(t, err, "method_not_found")
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	h := applettest.New(t, newRouter(t))
+	events, err := applettest.Stream[struct{}, int](h, "count", struct{}{})
+	assert.Equal(t, []int{1, 2, 3}, events)
+	applettest.RequireErrorCode(t, err, "not_found")
+
+	_, err = applettest.Stream[greetParams, greetResult](h, "greet", greetParams{Name: "ada"})
+	applettest.RequireErrorCode(t, err, "forbidden")
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "conflict", applettest.ErrorCode(fmt.Errorf("wrapped: %w", &applettest.Error{Code: "conflict"})))
+	assert.Equal(t, "", applettest.ErrorCode(errors.New("plain")))
+	assert.Equal(t, "", applettest.ErrorCode(nil))
+}
+
+func TestDevMode(t *testing.T) {
+	t.Parallel()
+
+	replayer, err := applets.LoadRPCReplayer(strings.NewReader(""))
+	require.NoError(t, err)
+	withReplayer := applettest.WithRPCConfig(func(cfg *applets.RPCConfig) { cfg.Replayer = replayer })
+	user := applettest.WithUser(applettest.NewUser(1, "greet"))
+
+	// Dev-only features stay off unless the test opts in.
+	res, err := applettest.Call[greetParams, greetResult](applettest.New(t, newRouter(t), user, withReplayer), "greet", greetParams{Name: "ada"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello ada", res.Greeting)
+
+	_, err = applettest.Call[greetParams, greetResult](applettest.New(t, newRouter(t), user, withReplayer, applettest.WithDevMode()), "greet", greetParams{Name: "ada"})
+	applettest.RequireErrorCode(t, err, "not_found")
+}
@@ -0,0 +1,112 @@
+package applettest
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/text/language"
+)
+
+// ErrNoUser is returned by Host.ExtractUser when there is no user, like a
+// host answering a request without a session.
+var ErrNoUser = errors.New("applettest: no user")
+
+type userKey struct{}
+
+// userValue is the user a Harness calls as; user is nil for calls without one.
+type userValue struct {
+	user applets.AppletUser
+}
+
+// Host is a fake applets.HostServices returning fixed values. The user a
+// Harness calls as takes precedence over User.
+type Host struct {
+	User     applets.AppletUser
+	TenantID uuid.UUID
+	// Locale defaults to English.
+	Locale language.Tag
+	Pool   *pgxpool.Pool
+}
+
+var _ applets.HostServices = (*Host)(nil)
+
+func (h *Host) ExtractUser(ctx context.Context) (applets.AppletUser, error) {
+	user := h.User
+	if v, ok := ctx.Value(userKey{}).(userValue); ok {
+		user = v.user
+	}
+	if user == nil {
+		return nil, ErrNoUser
+	}
+	return user, nil
+}
+
+func (h *Host) ExtractTenantID(ctx context.Context) (uuid.UUID, error) {
+	return h.TenantID, nil
+}
+
+func (h *Host) ExtractPool(ctx context.Context) (*pgxpool.Pool, error) {
+	return h.Pool, nil
+}
+
+func (h *Host) ExtractPageLocale(ctx context.Context) language.Tag {
+	if h.Locale == language.Und {
+		return language.English
+	}
+	return h.Locale
+}
+
+// User is a fake applets.DetailedUser.
+type User struct {
+	id          uint
+	email       string
+	firstName   string
+	lastName    string
+	permissions []string
+}
+
+var _ applets.DetailedUser = (*User)(nil)
+
+// NewUser returns a user with the given ID and permissions.
+func NewUser(id uint, permissions ...string) *User {
+	return &User{id: id, permissions: permissions}
+}
+
+// WithName sets the user's first and last name and returns the user.
+func (u *User) WithName(firstName, lastName string) *User {
+	u.firstName, u.lastName = firstName, lastName
+	return u
+}
+
+// WithEmail sets the user's email and returns the user.
+func (u *User) WithEmail(email string) *User {
+	u.email = email
+	return u
+}
+
+func (u *User) ID() uint          { return u.id }
+func (u *User) Email() string     { return u.email }
+func (u *User) FirstName() string { return u.firstName }
+func (u *User) LastName() string  { return u.lastName }
+
+func (u *User) DisplayName() string {
+	return strings.TrimSpace(u.firstName + " " + u.lastName)
+}
+
+func (u *User) HasPermission(name string) bool {
+	name = strings.TrimSpace(name)
+	for _, p := range u.permissions {
+		if strings.TrimSpace(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) PermissionNames() []string {
+	return u.permissions
+}
@@ -88,6 +88,9 @@ type AppletDevConfig struct {
 // AppletRPCConfig holds applet-specific RPC codegen settings.
 type AppletRPCConfig struct {
 	NeedsReexportShim bool `toml:"needs_reexport_shim"`
+	// Namespaces also emits nested TypeScript namespaces from dot-separated
+	// method names (chat.send -> <Type>.chat.send).
+	Namespaces bool `toml:"namespaces"`
 }
 
 // AppletEngineConfig holds per-applet engine runtime and backend settings.
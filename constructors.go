@@ -1,16 +1,25 @@
 package applets
 
 import (
+	stdcontext "context"
+	"encoding/json"
+	"io"
 	"net/http"
 
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets/internal/api"
 	"github.com/iota-uz/applets/internal/context"
 	"github.com/iota-uz/applets/internal/controller"
+	"github.com/iota-uz/applets/internal/idempotency"
+	"github.com/iota-uz/applets/internal/ratelimit"
+	"github.com/iota-uz/applets/internal/recording"
 	"github.com/iota-uz/applets/internal/registry"
 	"github.com/iota-uz/applets/internal/router"
 	"github.com/iota-uz/applets/internal/rpc"
 	"github.com/iota-uz/applets/internal/stream"
 	"github.com/iota-uz/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
 )
 
 func NewAppletController(
@@ -50,6 +59,10 @@ func NewStreamContextBuilder(
 	return stream.NewStreamContextBuilder(config, sessionConfig, logger, host)
 }
 
+func BuildStreamContext(ctx stdcontext.Context, b StreamContextBuilder, r *http.Request) (stdcontext.Context, *StreamContext, error) {
+	return api.BuildStreamContext(ctx, b, r)
+}
+
 func NewTypedRPCRouter() *TypedRPCRouter {
 	return rpc.NewTypedRPCRouter()
 }
@@ -58,6 +71,26 @@ func AddProcedure[P any, R any](r *TypedRPCRouter, name string, p Procedure[P, R
 	return rpc.AddProcedure(r, name, p)
 }
 
+func AddStreamProcedure[P any, E any](r *TypedRPCRouter, name string, p StreamProcedure[P, E]) error {
+	return rpc.AddStreamProcedure(r, name, p)
+}
+
+func AddUploadProcedure[P any, R any](r *TypedRPCRouter, name string, p UploadProcedure[P, R]) error {
+	return rpc.AddUploadProcedure(r, name, p)
+}
+
+func RegisterErrorCode[D any](r *TypedRPCRouter, code, message string) (ErrorCode[D], error) {
+	return rpc.RegisterErrorCode[D](r, code, message)
+}
+
+func NewAppletCaller(registry Registry, host HostServices) *AppletCaller {
+	return rpc.NewCaller(registry, host)
+}
+
+func CallApplet[P any, R any](ctx stdcontext.Context, c *AppletCaller, applet, method string, params P) (R, error) {
+	return rpc.CallApplet[P, R](ctx, c, applet, method, params)
+}
+
 func DescribeTypedRPCRouter(r *TypedRPCRouter) (*TypedRouterDescription, error) {
 	return rpc.DescribeTypedRPCRouter(r)
 }
@@ -70,6 +103,78 @@ func NewMuxRouter() AppletRouter {
 	return router.NewMuxRouter()
 }
 
+func NewTokenBucketRateLimiter(ratePerSecond float64, burst int) RateLimiter {
+	return ratelimit.NewTokenBucket(ratePerSecond, burst)
+}
+
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return idempotency.NewMemoryStore()
+}
+
+func NewJSONLRPCRecorder(w io.Writer) RPCRecorder {
+	return recording.NewJSONLRecorder(w)
+}
+
+func LoadRPCReplayer(r io.Reader) (RPCReplayer, error) {
+	return recording.LoadReplayer(r)
+}
+
+func HashRPCParams(params json.RawMessage) string {
+	return recording.HashParams(params)
+}
+
 func NewRegistry() Registry {
 	return registry.New()
 }
+
+func Perm(name string) PermissionExpr {
+	return api.Perm(name)
+}
+
+func AllOf(exprs ...PermissionExpr) PermissionExpr {
+	return api.AllOf(exprs...)
+}
+
+func AnyOf(exprs ...PermissionExpr) PermissionExpr {
+	return api.AnyOf(exprs...)
+}
+
+func Not(expr PermissionExpr) PermissionExpr {
+	return api.Not(expr)
+}
+
+func Func(name string, fn PermissionFunc) PermissionExpr {
+	return api.Func(name, fn)
+}
+
+func RPCConnectionFrom(ctx stdcontext.Context) (RPCConnection, bool) {
+	return api.RPCConnectionFrom(ctx)
+}
+
+func UserFrom(ctx stdcontext.Context) (AppletUser, bool) {
+	return api.UserFrom(ctx)
+}
+
+func TenantIDFrom(ctx stdcontext.Context) (uuid.UUID, bool) {
+	return api.TenantIDFrom(ctx)
+}
+
+func PermissionsFrom(ctx stdcontext.Context) ([]string, bool) {
+	return api.PermissionsFrom(ctx)
+}
+
+func LocaleFrom(ctx stdcontext.Context) (language.Tag, bool) {
+	return api.LocaleFrom(ctx)
+}
+
+func WithApplet(ctx stdcontext.Context, name string) stdcontext.Context {
+	return api.WithApplet(ctx, name)
+}
+
+func AppletFrom(ctx stdcontext.Context) (string, bool) {
+	return api.AppletFrom(ctx)
+}
+
+func IdentityFrom(ctx stdcontext.Context) (*Identity, bool) {
+	return api.IdentityFrom(ctx)
+}
@@ -5,6 +5,8 @@
 //
 // The implementation is split into internal packages (internal/api, internal/controller,
 // internal/context, internal/rpc, internal/router, internal/stream, internal/registry,
-// internal/validate, internal/security, internal/manifest). Only this root package
-// is part of the library's public API.
+// internal/validate, internal/security, internal/manifest, internal/ratelimit,
+// internal/idempotency, internal/tracing). Only this root package, the
+// applettest package for testing procedures and the rpcencoding package of
+// optional RPC payload encodings are part of the library's public API.
 package applets
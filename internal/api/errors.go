@@ -1,6 +1,9 @@
 package api
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 // Sentinel errors for applet operations. Use errors.Is() to check.
 var (
@@ -9,14 +12,90 @@ var (
 	ErrNotFound         = errors.New("not found")
 	ErrPermissionDenied = errors.New("permission denied")
 	ErrInternal         = errors.New("internal")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrConflict         = errors.New("conflict")
+	ErrPayloadTooLarge  = errors.New("payload too large")
 )
 
 // ErrorClassifier allows errors to self-classify into semantic RPC error codes.
 // Implement this interface on structured error types (e.g. serrors.Error) so the
 // RPC handler can map domain errors to proper codes without sentinel wrapping.
 //
-// Recognized return values: "validation", "invalid", "not_found", "forbidden", "internal".
-// Return "" to fall through to default handling.
+// Recognized return values: "validation", "invalid", "not_found", "forbidden", "internal", "rate_limited", "conflict", "payload_too_large".
+// Return "" to fall through to default handling. For applet-specific codes use
+// an ErrorCode registered on the router instead.
 type ErrorClassifier interface {
 	ErrorKind() string
 }
+
+// FieldError describes one params field that failed validation.
+// Field is the JSON path of the value (e.g. "items[0].name").
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports field-level params validation failures. It wraps
+// ErrValidation, and the RPC endpoint always returns Fields in the error
+// details so forms can map them to inputs.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrValidation }
+
+// CodedError is a domain error with an applet-defined code, created from an
+// ErrorCode. The RPC endpoint returns its Code, Message and Details as is, so
+// Message must be safe to show to users.
+type CodedError struct {
+	Code    string
+	Message string
+	Details any
+	// Err is the underlying cause. It is logged but never sent to clients.
+	Err error
+}
+
+func (e *CodedError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *CodedError) Unwrap() error { return e.Err }
+
+// ErrorCode is a domain error code registered on a TypedRPCRouter with
+// RegisterErrorCode. D is the type of the error's details; use struct{} for
+// codes without details.
+type ErrorCode[D any] struct {
+	Code    string
+	Message string
+}
+
+// New returns an error with this code and the given details.
+func (c ErrorCode[D]) New(details D) *CodedError {
+	return c.Wrap(nil, details)
+}
+
+// Wrap returns an error with this code and the given details caused by err.
+func (c ErrorCode[D]) Wrap(err error, details D) *CodedError {
+	e := &CodedError{Code: c.Code, Message: c.Message, Err: err}
+	if !isEmptyStruct(details) {
+		e.Details = details
+	}
+	return e
+}
+
+func isEmptyStruct(v any) bool {
+	_, ok := v.(struct{})
+	return ok
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/language"
+)
+
+// Identity is the caller of a request. The RPC endpoint and
+// BuildStreamContext extract it once through HostServices and store it in the
+// request context; read it with UserFrom, TenantIDFrom,
+// PermissionsFrom and LocaleFrom.
+type Identity struct {
+	User        AppletUser
+	TenantID    uuid.UUID
+	Permissions []string
+	Locale      language.Tag
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity stored in ctx, if any.
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// UserFrom returns the user of the request ctx belongs to.
+func UserFrom(ctx context.Context) (AppletUser, bool) {
+	id, ok := IdentityFrom(ctx)
+	if !ok || id.User == nil {
+		return nil, false
+	}
+	return id.User, true
+}
+
+// TenantIDFrom returns the tenant of the request ctx belongs to.
+func TenantIDFrom(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := IdentityFrom(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return id.TenantID, true
+}
+
+// PermissionsFrom returns the permission names of the request's user.
+func PermissionsFrom(ctx context.Context) ([]string, bool) {
+	id, ok := IdentityFrom(ctx)
+	if !ok {
+		return nil, false
+	}
+	return id.Permissions, true
+}
+
+// LocaleFrom returns the page locale of the request ctx belongs to.
+func LocaleFrom(ctx context.Context) (language.Tag, bool) {
+	id, ok := IdentityFrom(ctx)
+	if !ok {
+		return language.Und, false
+	}
+	return id.Locale, true
+}
+
+type appletKey struct{}
+
+// WithApplet returns ctx carrying the name of the applet serving the request.
+func WithApplet(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, appletKey{}, name)
+}
+
+// AppletFrom returns the name of the applet serving the request ctx belongs to.
+// The controller sets it for RPC calls and page renders; StreamContextBuilder
+// does not know the applet, so SSE handlers only see it when the host set it
+// with WithApplet.
+func AppletFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(appletKey{}).(string)
+	return name, ok && name != ""
+}
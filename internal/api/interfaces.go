@@ -2,7 +2,10 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +24,13 @@ type MetricsRecorder interface {
 	IncrementCounter(name string, labels map[string]string)
 }
 
+// ValueRecorder is an optional MetricsRecorder extension for recording
+// distributions such as RPC payload sizes. Recorders that do not implement it
+// only receive durations and counters.
+type ValueRecorder interface {
+	RecordValue(name string, value float64, labels map[string]string)
+}
+
 // SessionStore reads session expiry from the session backend.
 type SessionStore interface {
 	GetSessionExpiry(r *http.Request) time.Time
@@ -34,11 +44,157 @@ type HostServices interface {
 	ExtractPageLocale(ctx context.Context) language.Tag
 }
 
+// RateLimitKey identifies who is calling which RPC method.
+type RateLimitKey struct {
+	UserID   uint
+	TenantID string
+	Method   string
+}
+
+// String returns a stable representation of the key for shared backends.
+func (k RateLimitKey) String() string {
+	return k.TenantID + ":" + strconv.FormatUint(uint64(k.UserID), 10) + ":" + k.Method
+}
+
+// RateLimitDecision is the outcome of a rate limit check.
+type RateLimitDecision struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// RateLimiter decides whether an RPC call may proceed. Implementations backed
+// by a shared store can be set on RPCConfig (all methods) or on a Procedure.
+type RateLimiter interface {
+	Allow(ctx context.Context, key RateLimitKey) (RateLimitDecision, error)
+}
+
+// IdempotencyStatus is the state of an idempotency key in an IdempotencyStore.
+type IdempotencyStatus int
+
+const (
+	// IdempotencyNew means the key was unused and is now reserved by the caller.
+	IdempotencyNew IdempotencyStatus = iota
+	// IdempotencyInFlight means another call holding the key has not finished yet.
+	IdempotencyInFlight
+	// IdempotencyCompleted means a call with the key already finished and its response is stored.
+	IdempotencyCompleted
+)
+
+// IdempotencyStore remembers the responses of idempotent RPC calls so retries
+// with the same key replay the first result instead of running again.
+type IdempotencyStore interface {
+	// Reserve claims key for ttl. When the key is already taken it reports the
+	// existing state and, for completed calls, the stored response.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (IdempotencyStatus, []byte, error)
+	// Complete stores the response for a reserved key, keeping it for ttl.
+	Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	// Release drops a reservation so the call can be retried.
+	Release(ctx context.Context, key string) error
+}
+
 // TenantNameResolver resolves a tenant ID to a tenant name.
 type TenantNameResolver interface {
 	ResolveTenantName(tenantID string) (string, error)
 }
 
+// RPCCodec encodes RPC requests and responses for one media type, e.g. a
+// MessagePack codec for "application/msgpack". Handlers always see params as
+// JSON: requests are decoded with Unmarshal into generic values (maps, slices,
+// strings, numbers, booleans, nil) and converted, and responses are converted
+// to generic values before Marshal. JSON is built in.
+type RPCCodec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// RPCCompressor handles one Content-Encoding for RPC bodies, e.g. "br".
+// gzip is built in.
+type RPCCompressor interface {
+	Encoding() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Tracer starts spans for context building, rendering and RPC calls. Hosts
+// adapt it to their tracing backend (e.g. OpenTelemetry); see WithTracer.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key, value string)
+	RecordError(err error)
+	End()
+}
+
+// TracerConfigurator is implemented by configurators that accept a Tracer.
+// Used by WithTracer.
+type TracerConfigurator interface {
+	SetTracer(Tracer)
+}
+
+// AuditEvent records one call to an audited RPC method.
+type AuditEvent struct {
+	RequestID string
+	UserID    uint
+	TenantID  string
+	Method    string
+	// Params are the call's params with `audit` tags applied: fields tagged
+	// `audit:"redact"` are replaced by "[REDACTED]" and `audit:"omit"` are
+	// dropped. Nil for methods not registered through TypedRPCRouter.
+	Params   any
+	Code     string
+	Duration time.Duration
+	Time     time.Time
+}
+
+// AuditSink receives audit events for RPC methods that opt in with
+// Procedure.Audit. Record runs synchronously after each call; errors are logged.
+type AuditSink interface {
+	Record(ctx context.Context, event AuditEvent) error
+}
+
+// AuditSinkConfigurator is implemented by configurators that accept an
+// AuditSink. Used by WithAuditSink.
+type AuditSinkConfigurator interface {
+	SetAuditSink(AuditSink)
+}
+
+// RPCRecord is one call written by an RPCRecorder and served by an
+// RPCReplayer. ParamsHash identifies the call's params independently of key
+// order and whitespace; Params, Result and Error.Details have `audit` tags
+// applied (see AuditEvent.Params).
+type RPCRecord struct {
+	Time       time.Time       `json:"time"`
+	Method     string          `json:"method"`
+	ParamsHash string          `json:"paramsHash"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      *RPCRecordError `json:"error,omitempty"`
+	DurationMs int64           `json:"durationMs"`
+}
+
+// RPCRecordError is the error response of a recorded call.
+type RPCRecordError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// RPCRecorder receives completed calls when set as RPCConfig.Recorder. Record
+// runs synchronously after each call; errors are logged.
+type RPCRecorder interface {
+	Record(ctx context.Context, rec RPCRecord) error
+}
+
+// RPCReplayer answers calls from recordings when set as RPCConfig.Replayer.
+// Replay reports false when there is no recording for the call.
+type RPCReplayer interface {
+	Replay(ctx context.Context, method, paramsHash string) (RPCRecord, bool)
+}
+
 // ContextBuilderConfigurator is implemented by the context builder for optional configuration.
 // Used by WithTenantNameResolver, WithErrorEnricher, WithSessionStore.
 type ContextBuilderConfigurator interface {
@@ -54,3 +210,23 @@ type BuilderOption func(ContextBuilderConfigurator)
 type ContextBuilder interface {
 	Build(ctx context.Context, r *http.Request, basePath string) (*InitialContext, error)
 }
+
+// RPCConnection is a WebSocket RPC connection. Notify sends a notification
+// to the client; Done is closed once the connection ends.
+type RPCConnection interface {
+	Notify(method string, params any) error
+	Done() <-chan struct{}
+}
+
+type rpcConnectionKey struct{}
+
+// WithRPCConnection returns ctx carrying conn.
+func WithRPCConnection(ctx context.Context, conn RPCConnection) context.Context {
+	return context.WithValue(ctx, rpcConnectionKey{}, conn)
+}
+
+// RPCConnectionFrom returns the WebSocket connection a call arrived on, if any.
+func RPCConnectionFrom(ctx context.Context) (RPCConnection, bool) {
+	conn, ok := ctx.Value(rpcConnectionKey{}).(RPCConnection)
+	return conn, ok
+}
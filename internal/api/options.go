@@ -20,3 +20,22 @@ func WithSessionStore(store SessionStore) BuilderOption {
 		c.SetSessionStore(store)
 	}
 }
+
+// WithTracer sets the tracer used for context building, rendering and RPC spans.
+func WithTracer(tracer Tracer) BuilderOption {
+	return func(c ContextBuilderConfigurator) {
+		if tc, ok := c.(TracerConfigurator); ok {
+			tc.SetTracer(tracer)
+		}
+	}
+}
+
+// WithAuditSink sets the sink for audited RPC calls. It applies to the applet
+// controller; a standalone context builder ignores it.
+func WithAuditSink(sink AuditSink) BuilderOption {
+	return func(c ContextBuilderConfigurator) {
+		if ac, ok := c.(AuditSinkConfigurator); ok {
+			ac.SetAuditSink(sink)
+		}
+	}
+}
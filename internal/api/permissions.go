@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PermissionExpr is a permission check built from Perm, AllOf, AnyOf, Not and
+// Func. params are the raw call params, or nil outside of RPC calls.
+type PermissionExpr interface {
+	Allows(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error)
+	Describe() PermissionDescription
+	String() string
+}
+
+// PermissionDescription is the JSON form of a PermissionExpr. Op is one of
+// "perm", "allOf", "anyOf", "not" or "func"; Name is the permission for
+// "perm" and the predicate name for "func".
+type PermissionDescription struct {
+	Op   string                  `json:"op"`
+	Name string                  `json:"name,omitempty"`
+	Args []PermissionDescription `json:"args,omitempty"`
+}
+
+// PermissionFunc is a custom permission predicate, e.g. resource ownership.
+type PermissionFunc func(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error)
+
+// Perm requires a single permission, checked with AppletUser.HasPermission.
+func Perm(name string) PermissionExpr { return permExpr(name) }
+
+// AllOf requires every expression. AllOf() always allows.
+func AllOf(exprs ...PermissionExpr) PermissionExpr { return allOfExpr(compactExprs(exprs)) }
+
+// AnyOf requires at least one expression. AnyOf() never allows.
+func AnyOf(exprs ...PermissionExpr) PermissionExpr { return anyOfExpr(compactExprs(exprs)) }
+
+// Not inverts expr.
+func Not(expr PermissionExpr) PermissionExpr { return notExpr{expr: expr} }
+
+// Func wraps a custom predicate. name identifies it in descriptions and errors;
+// clients cannot evaluate it and leave the decision to the server.
+func Func(name string, fn PermissionFunc) PermissionExpr { return funcExpr{name: name, fn: fn} }
+
+// AuthorizeMethod checks m's RequirePermissions and then its Permissions
+// expression for user, which is nil when the caller has none. Failed checks
+// wrap ErrPermissionDenied; errors from custom predicates are returned as
+// they are. HTTP calls and in-process calls both authorize through it.
+func AuthorizeMethod(ctx context.Context, user AppletUser, m RPCMethod, params json.RawMessage) error {
+	if err := RequirePermissions(user, m.RequirePermissions); err != nil {
+		return err
+	}
+	return CheckPermission(ctx, user, m.Permissions, params)
+}
+
+// RequirePermissions checks that user has every permission in required.
+func RequirePermissions(user AppletUser, required []string) error {
+	for _, need := range required {
+		if need == "" {
+			continue
+		}
+		if user == nil {
+			return fmt.Errorf("no user: %w", ErrPermissionDenied)
+		}
+		if !user.HasPermission(need) {
+			return fmt.Errorf("missing permission %q: %w", need, ErrPermissionDenied)
+		}
+	}
+	return nil
+}
+
+// CheckPermission evaluates expr for user. A nil expr allows.
+func CheckPermission(ctx context.Context, user AppletUser, expr PermissionExpr, params json.RawMessage) error {
+	if expr == nil {
+		return nil
+	}
+	if user == nil {
+		return fmt.Errorf("no user: %w", ErrPermissionDenied)
+	}
+	ok, err := expr.Allows(ctx, user, params)
+	if err != nil {
+		return fmt.Errorf("%s: %w", expr, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s not satisfied: %w", expr, ErrPermissionDenied)
+	}
+	return nil
+}
+
+func compactExprs(exprs []PermissionExpr) []PermissionExpr {
+	out := make([]PermissionExpr, 0, len(exprs))
+	for _, e := range exprs {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+type permExpr string
+
+func (e permExpr) Allows(_ context.Context, user AppletUser, _ json.RawMessage) (bool, error) {
+	return user != nil && user.HasPermission(string(e)), nil
+}
+
+func (e permExpr) Describe() PermissionDescription {
+	return PermissionDescription{Op: "perm", Name: string(e)}
+}
+
+func (e permExpr) String() string { return string(e) }
+
+type allOfExpr []PermissionExpr
+
+func (e allOfExpr) Allows(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error) {
+	for _, sub := range e {
+		ok, err := sub.Allows(ctx, user, params)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (e allOfExpr) Describe() PermissionDescription {
+	return PermissionDescription{Op: "allOf", Args: describeExprs(e)}
+}
+
+func (e allOfExpr) String() string { return "allOf(" + joinExprs(e) + ")" }
+
+type anyOfExpr []PermissionExpr
+
+func (e anyOfExpr) Allows(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error) {
+	for _, sub := range e {
+		ok, err := sub.Allows(ctx, user, params)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (e anyOfExpr) Describe() PermissionDescription {
+	return PermissionDescription{Op: "anyOf", Args: describeExprs(e)}
+}
+
+func (e anyOfExpr) String() string { return "anyOf(" + joinExprs(e) + ")" }
+
+type notExpr struct{ expr PermissionExpr }
+
+func (e notExpr) Allows(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error) {
+	if e.expr == nil {
+		return false, nil
+	}
+	ok, err := e.expr.Allows(ctx, user, params)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+func (e notExpr) Describe() PermissionDescription {
+	d := PermissionDescription{Op: "not"}
+	if e.expr != nil {
+		d.Args = []PermissionDescription{e.expr.Describe()}
+	}
+	return d
+}
+
+func (e notExpr) String() string {
+	if e.expr == nil {
+		return "not()"
+	}
+	return "not(" + e.expr.String() + ")"
+}
+
+type funcExpr struct {
+	name string
+	fn   PermissionFunc
+}
+
+func (e funcExpr) Allows(ctx context.Context, user AppletUser, params json.RawMessage) (bool, error) {
+	if e.fn == nil {
+		return false, nil
+	}
+	return e.fn(ctx, user, params)
+}
+
+func (e funcExpr) Describe() PermissionDescription {
+	return PermissionDescription{Op: "func", Name: e.name}
+}
+
+func (e funcExpr) String() string { return "func(" + e.name + ")" }
+
+func describeExprs(exprs []PermissionExpr) []PermissionDescription {
+	out := make([]PermissionDescription, len(exprs))
+	for i, e := range exprs {
+		out[i] = e.Describe()
+	}
+	return out
+}
+
+func joinExprs(exprs []PermissionExpr) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
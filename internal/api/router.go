@@ -34,3 +34,22 @@ type StreamWriter interface {
 type StreamContextBuilder interface {
 	Build(ctx context.Context, r *http.Request) (*StreamContext, error)
 }
+
+// IdentityStreamContextBuilder is implemented by StreamContextBuilders that
+// can also return ctx carrying the caller's Identity, so SSE handlers can use
+// UserFrom and the other accessors. The builder from internal/stream does;
+// call it through BuildStreamContext.
+type IdentityStreamContextBuilder interface {
+	BuildContext(ctx context.Context, r *http.Request) (context.Context, *StreamContext, error)
+}
+
+// BuildStreamContext builds a StreamContext with b and returns ctx carrying
+// the caller's Identity when b implements IdentityStreamContextBuilder, or ctx
+// unchanged otherwise.
+func BuildStreamContext(ctx context.Context, b StreamContextBuilder, r *http.Request) (context.Context, *StreamContext, error) {
+	if ib, ok := b.(IdentityStreamContextBuilder); ok {
+		return ib.BuildContext(ctx, r)
+	}
+	streamCtx, err := b.Build(ctx, r)
+	return ctx, streamCtx, err
+}
@@ -1,25 +1,192 @@
 package api
 
-import "context"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 // Procedure defines a typed RPC procedure (params P, result R).
 type Procedure[P any, R any] struct {
 	RequirePermissions []string
-	Handler            func(ctx context.Context, params P) (R, error)
+	// Permissions must allow the caller in addition to RequirePermissions,
+	// e.g. AnyOf(Perm("Chat.ReadAll"), Func("owner", isOwner)).
+	Permissions PermissionExpr
+	// Interceptors wrap this procedure only; they run after router-level interceptors.
+	Interceptors []RPCInterceptor
+	// RateLimiter limits calls to this procedure on top of RPCConfig.RateLimiter.
+	RateLimiter RateLimiter
+	// Idempotent makes calls that carry an idempotency key replay the first
+	// successful result instead of running the handler again.
+	Idempotent bool
+	// Timeout bounds a single call; zero uses RPCConfig.Timeout.
+	Timeout time.Duration
+	// MaxBodyBytes limits the request body of a call to this procedure in
+	// place of RPCConfig.MaxBodyBytes. It does not apply inside batches.
+	MaxBodyBytes int64
+	// Query marks a read-only procedure that may also be called with GET and
+	// URL-encoded params. GET responses carry an ETag and honor If-None-Match.
+	Query bool
+	// CacheControl is the Cache-Control header for successful GET responses of
+	// a query procedure. Defaults to "private, no-cache". Responses to callers
+	// with a user are always made private and vary on Cookie.
+	CacheControl string
+	// Deprecated marks the procedure as deprecated; see Deprecation.
+	Deprecated *Deprecation
+	// Audit sends every call to the AuditSink set with WithAuditSink.
+	Audit bool
+	// Errors lists the error codes the procedure may return: codes registered
+	// with RegisterErrorCode or built-in codes such as "not_found".
+	Errors  []string
+	Handler func(ctx context.Context, params P) (R, error)
 }
 
+// Deprecation marks a procedure as deprecated. Calls to it are logged and
+// answered with Deprecation and Sunset headers, and generated clients mark it
+// @deprecated. Register a replacement under a versioned name such as
+// "chat.send@v2".
+type Deprecation struct {
+	Message string
+	// Sunset is when the procedure is expected to be removed; zero if unknown.
+	Sunset time.Time
+}
+
+// StreamProcedure defines a typed streaming RPC procedure (params P, events E).
+// It is served as server-sent events on the RPC path: every emitted event is
+// sent as it is produced and the stream ends when Handler returns.
+type StreamProcedure[P any, E any] struct {
+	RequirePermissions []string
+	Permissions        PermissionExpr
+	Interceptors       []RPCInterceptor
+	RateLimiter        RateLimiter
+	Deprecated         *Deprecation
+	Errors             []string
+	// MaxBodyBytes overrides RPCConfig.MaxBodyBytes for this procedure.
+	MaxBodyBytes int64
+	Handler      func(ctx context.Context, params P, emit StreamEmitter[E]) error
+}
+
+// UploadProcedure defines a typed procedure that receives files along with
+// params P and returns R. It is called with a multipart/form-data POST whose
+// first part, named "request", holds the usual {"id","method","params"} JSON;
+// every following part is a file. Files are streamed to Handler in order and
+// are not buffered, so Handler must read each file before asking for the next.
+type UploadProcedure[P any, R any] struct {
+	RequirePermissions []string
+	Permissions        PermissionExpr
+	Interceptors       []RPCInterceptor
+	RateLimiter        RateLimiter
+	Timeout            time.Duration
+	Deprecated         *Deprecation
+	Audit              bool
+	Errors             []string
+	// MaxBodyBytes limits the whole multipart body; defaults to 32 MiB.
+	MaxBodyBytes int64
+	// MaxFileBytes limits each file; zero leaves only MaxBodyBytes.
+	MaxFileBytes int64
+	// AllowedTypes lists the accepted file media types, such as "text/csv"
+	// or "image/*". Empty accepts any type.
+	AllowedTypes []string
+	Handler      func(ctx context.Context, params P, files UploadFiles) (R, error)
+}
+
+// UploadFiles iterates the files of an upload. Next returns io.EOF after the
+// last file. A file over the size limit fails with ErrPayloadTooLarge while
+// it is read; a file of a type that is not allowed fails Next with ErrInvalid.
+type UploadFiles interface {
+	Next() (*UploadFile, error)
+}
+
+// UploadFile is one file of an upload. Body is only valid until the next
+// call to UploadFiles.Next.
+type UploadFile struct {
+	// Field is the name of the form field the file was sent as.
+	Field       string
+	Filename    string
+	ContentType string
+	Body        io.Reader
+}
+
+type uploadFilesKey struct{}
+
+// WithUploadFiles returns ctx carrying the files of an upload call.
+func WithUploadFiles(ctx context.Context, files UploadFiles) context.Context {
+	return context.WithValue(ctx, uploadFilesKey{}, files)
+}
+
+// UploadFilesFrom returns the files of the upload call ctx belongs to, if any.
+func UploadFilesFrom(ctx context.Context) (UploadFiles, bool) {
+	files, ok := ctx.Value(uploadFilesKey{}).(UploadFiles)
+	return files, ok
+}
+
+// StreamEmitter sends one event to the caller of a streaming procedure.
+// It returns an error once the client has gone away.
+type StreamEmitter[E any] func(event E) error
+
+// RPCNext continues an interceptor chain with the given params.
+type RPCNext func(ctx context.Context, params any) (any, error)
+
+// RPCInterceptor wraps a typed procedure call. params holds the decoded
+// params value (the procedure's P); interceptors may pass a replacement of the
+// same type to next, or return without calling next to short-circuit the call.
+type RPCInterceptor func(ctx context.Context, method string, params any, next RPCNext) (any, error)
+
 // TypedRouterDescription is the JSON-serializable description of a TypedRPCRouter (for codegen).
 type TypedRouterDescription struct {
 	Methods []TypedMethodDescription   `json:"methods"`
 	Types   map[string]TypedTypeObject `json:"types"`
+	// Encodings is set when the router registers codecs or compressors beyond
+	// the built-in JSON and gzip.
+	Encodings *TypedEncodings `json:"encodings,omitempty"`
+	// Errors lists the router's registered error codes.
+	Errors []TypedErrorDescription `json:"errors,omitempty"`
+}
+
+// TypedErrorDescription describes a registered error code. Details is nil for
+// codes without details.
+type TypedErrorDescription struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details *TypeRef `json:"details,omitempty"`
+}
+
+// TypedEncodings lists the payload encodings a router supports.
+type TypedEncodings struct {
+	ContentTypes     []string `json:"contentTypes"`
+	ContentEncodings []string `json:"contentEncodings"`
 }
 
 // TypedMethodDescription describes a single RPC method.
 type TypedMethodDescription struct {
 	Name               string   `json:"name"`
 	RequirePermissions []string `json:"requirePermissions,omitempty"`
-	Params             TypeRef  `json:"params"`
-	Result             TypeRef  `json:"result"`
+	// Permissions describes the procedure's PermissionExpr. Clients can use it
+	// to hide actions; "func" nodes can only be decided by the server.
+	Permissions *PermissionDescription `json:"permissions,omitempty"`
+	Params      TypeRef                `json:"params"`
+	Result      TypeRef                `json:"result"`
+	// Stream marks a streaming procedure; Result then describes a single event.
+	Stream     bool `json:"stream,omitempty"`
+	Idempotent bool `json:"idempotent,omitempty"`
+	// Query marks a procedure that clients may call with GET.
+	Query bool `json:"query,omitempty"`
+	// Version is the "vN" suffix of a versioned name such as "chat.send@v2".
+	Version            string `json:"version,omitempty"`
+	Deprecated         bool   `json:"deprecated,omitempty"`
+	DeprecationMessage string `json:"deprecationMessage,omitempty"`
+	// Sunset is the planned removal date (YYYY-MM-DD).
+	Sunset string `json:"sunset,omitempty"`
+	// Errors lists the error codes the method declares.
+	Errors []string `json:"errors,omitempty"`
+	// Upload is set for upload procedures, which take files next to Params.
+	Upload *TypedUploadDescription `json:"upload,omitempty"`
+}
+
+// TypedUploadDescription describes the files an upload procedure accepts.
+type TypedUploadDescription struct {
+	MaxFileBytes int64    `json:"maxFileBytes,omitempty"`
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
 }
 
 // TypedTypeObject describes a type for codegen.
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io/fs"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/gorilla/mux"
@@ -63,6 +64,9 @@ type Config struct {
 	Middleware    []mux.MiddlewareFunc
 	Mount         MountConfig
 	RPC           *RPCConfig
+	// Permissions, when set, must allow the user for applet pages to render;
+	// other users get 403 Forbidden.
+	Permissions PermissionExpr
 }
 
 // LayoutFactory produces a layout component for an applet request.
@@ -100,17 +104,148 @@ type DevAssetConfig struct {
 }
 
 // RPCConfig configures the applet RPC endpoint.
+//
+// The endpoint accepts either a single request object or a JSON array of
+// requests (a batch). Query methods may also be called with
+// GET <Path>?method=<name>&params=<json>.
 type RPCConfig struct {
 	Path                 string
 	ExposeInternalErrors *bool
-	MaxBodyBytes         int64
-	Methods              map[string]RPCMethod
+	// MaxBodyBytes limits request bodies after decompression (default 1 MiB).
+	// Procedures may set their own limit for single calls; batches always use
+	// MaxBodyBytes. Upload procedures have limits of their own; see
+	// UploadProcedure.
+	MaxBodyBytes int64
+	// MaxBatchSize caps the number of calls in a batch (default 32).
+	MaxBatchSize int
+	// BatchConcurrency caps how many calls of a batch run at once (0 or 1 runs
+	// them sequentially).
+	BatchConcurrency int
+	// RateLimiter, when set, is checked for every call in addition to any
+	// per-method limiter.
+	RateLimiter RateLimiter
+	// IdempotencyStore keeps results of idempotent methods, replayed for a
+	// repeated Idempotency-Key header or "idempotencyKey" field (default
+	// in-memory). Keys are scoped to the user and tenant; reusing one with
+	// different params fails with "conflict", and calls without a user are
+	// never replayed.
+	IdempotencyStore IdempotencyStore
+	// IdempotencyTTL is how long results are kept (default 24h).
+	IdempotencyTTL time.Duration
+	// Timeout, when positive, cancels a call's context once it expires and
+	// answers with a "timeout" error; methods may override it. Streams are not
+	// bounded. Handlers must honor ctx: one that keeps running after the
+	// timeout holds its idempotency key until it returns, and its outcome is
+	// discarded.
+	Timeout time.Duration
+	// Codecs are negotiated from Content-Type and Accept; JSON is the default.
+	// The rpcencoding package provides a MessagePack codec.
+	Codecs []RPCCodec
+	// Compressors decode request bodies and encode responses in addition to
+	// gzip, which they are preferred over. The rpcencoding package provides a
+	// brotli compressor.
+	Compressors []RPCCompressor
+	// CompressionThreshold is the response size from which responses are
+	// compressed with the first supported Accept-Encoding (default 8 KiB,
+	// negative disables).
+	CompressionThreshold int
+	// Recorder, when set, receives every completed non-streaming call, e.g. to
+	// build fixtures.
+	Recorder RPCRecorder
+	// Replayer, when set, answers non-streaming calls with the recorded
+	// response for the method and params hash instead of running handlers,
+	// permission checks or limiters; calls without a recording fail with
+	// "not_found". It is only honored while the dev proxy is enabled
+	// (AssetConfig.Dev.Enabled) and is otherwise ignored with an error logged
+	// at startup.
+	Replayer RPCReplayer
+	// WebSocket, when set, also serves WebSocket upgrade requests to Path.
+	WebSocket *RPCWebSocketConfig
+	// Introspection, when set, serves the output of Describe as JSON at
+	// GET <Path>?method=__describe. While the dev proxy is enabled, a
+	// playground for the described procedures is served at
+	// <base path>/__playground. TypedRPCRouter.Config sets Describe.
+	Introspection *RPCIntrospectionConfig
+	Describe      func() (*TypedRouterDescription, error)
+	// ErrorCodes lists the domain error codes procedures may return; calls
+	// that fail with one are recorded under that code in metrics instead of
+	// "other". TypedRPCRouter.Config sets it from RegisterErrorCode.
+	ErrorCodes []string
+	Methods    map[string]RPCMethod
+}
+
+// RPCIntrospectionConfig controls who may read the RPC description endpoint.
+// A request is allowed when Dev is set and the dev proxy is enabled
+// (AssetConfig.Dev.Enabled), or when the user satisfies Permissions; any
+// other request is answered with 403.
+type RPCIntrospectionConfig struct {
+	Dev         bool
+	Permissions PermissionExpr
+}
+
+// RPCWebSocketConfig configures the WebSocket transport of the RPC endpoint.
+//
+// Each text message from the client is one call in the same shape as a POST
+// body; calls run concurrently and are answered with {"id","result"|"error"}
+// in completion order. Streaming methods send {"id","event"} per event and
+// {"id","done":true} at the end. Server notifications are sent as
+// {"method","params"} without an id.
+//
+// The upgrade is refused unless the Origin is the request's host or one of
+// AllowedOrigins and the user can be extracted through HostServices. When the
+// host uses CSRF protection, the ticket query parameter must also hold a
+// ticket from the built-in "__wsTicket" method, called with a regular POST
+// that the CSRF check covers; tickets are single-use, bound to the user and
+// expire after 30 seconds. Permissions are still checked on every call.
+//
+// Every write times out after 10 seconds. The server pings every
+// PingInterval and drops clients that answer no ping within two intervals.
+type RPCWebSocketConfig struct {
+	// AllowedOrigins lists extra allowed origins such as "https://app.example.com".
+	AllowedOrigins []string
+	// MaxMessageBytes limits incoming messages; defaults to RPCConfig.MaxBodyBytes.
+	MaxMessageBytes int64
+	// MaxConcurrentCalls limits the calls running at once per connection
+	// (default 16); further messages wait.
+	MaxConcurrentCalls int
+	// PingInterval is how often the server pings the client (default 30s,
+	// negative disables pings and the liveness check).
+	PingInterval time.Duration
+	// OnConnect, when set, is called once the connection is established, e.g.
+	// to subscribe it to server-side events. ctx ends with the connection.
+	OnConnect func(ctx context.Context, conn RPCConnection)
 }
 
 // RPCMethod describes a single RPC method (used internally when building from TypedRPCRouter).
+// Streaming methods set Stream instead of Handler.
 type RPCMethod struct {
 	RequirePermissions []string
-	Handler            func(ctx context.Context, params json.RawMessage) (any, error)
+	// Permissions is checked after RequirePermissions.
+	Permissions  PermissionExpr
+	Handler      func(ctx context.Context, params json.RawMessage) (any, error)
+	Stream       func(ctx context.Context, params json.RawMessage, emit func(event any) error) error
+	RateLimiter  RateLimiter
+	Idempotent   bool
+	Timeout      time.Duration
+	Query        bool
+	CacheControl string
+	Deprecated   *Deprecation
+	Audit        bool
+	// MaxBodyBytes overrides RPCConfig.MaxBodyBytes for single calls.
+	MaxBodyBytes int64
+	// Upload marks a method called with a multipart body; Handler then finds
+	// the files in its context (see UploadFilesFrom). The files are read from
+	// the request body, so the response waits for Handler to return even
+	// after a timeout; reading files once the call ended fails.
+	Upload       bool
+	MaxFileBytes int64
+	AllowedTypes []string
+	// AuditParams returns the redacted params recorded in AuditEvent.Params.
+	AuditParams func(params json.RawMessage) any
+	// RedactParams and RedactResult apply `audit` tags to what
+	// RPCConfig.Recorder stores. Without them values are stored as is.
+	RedactParams func(params json.RawMessage) any
+	RedactResult func(result any) any
 }
 
 // ContextExtender adds custom fields to InitialContext.Extensions.
@@ -20,6 +20,7 @@ type Config struct {
 	RouterPackage string
 	RouterFunc    string
 	OutputPath    string // Explicit output path override; when empty, falls back to TargetOut heuristic
+	Namespaces    bool   // Also emit nested TypeScript namespaces from dot-separated method names
 	TargetOut     string
 	SDKOut        string
 	ModuleOut     string
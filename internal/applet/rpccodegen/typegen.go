@@ -1,11 +1,13 @@
 package rpccodegen
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/iota-uz/applets"
 )
@@ -27,19 +29,97 @@ func EmitTypeScript(desc *applets.TypedRouterDescription, typeName string) (stri
 	b.WriteString(typeName)
 	b.WriteString(" = {\n")
 
+	errorDetails := make(map[string]*applets.TypeRef, len(desc.Errors))
+	for _, e := range desc.Errors {
+		errorDetails[e.Code] = e.Details
+	}
+
 	methods := append([]applets.TypedMethodDescription(nil), desc.Methods...)
 	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
 	for _, m := range methods {
+		if m.Deprecated {
+			b.WriteString("  /** ")
+			b.WriteString(deprecatedDoc(m))
+			b.WriteString(" */\n")
+		}
 		b.WriteString("  ")
 		b.WriteString(fmt.Sprintf("%q", m.Name))
 		b.WriteString(": { params: ")
 		b.WriteString(emitTypeRef(m.Params))
+		if m.Upload != nil {
+			// Upload procedures also take files, sent as multipart parts.
+			b.WriteString("; files: (File | Blob)[]")
+		}
 		b.WriteString("; result: ")
-		b.WriteString(emitTypeRef(m.Result))
+		if m.Stream {
+			// Streaming procedures yield events until the server closes the stream.
+			b.WriteString("AsyncIterable<")
+			b.WriteString(emitTypeRef(m.Result))
+			b.WriteString(">; stream: true")
+		} else {
+			b.WriteString(emitTypeRef(m.Result))
+		}
+		if m.Query {
+			b.WriteString("; query: true")
+		}
+		if len(m.Errors) > 0 {
+			b.WriteString("; errors: ")
+			b.WriteString(emitErrorUnion(m.Errors, errorDetails))
+		}
 		b.WriteString(" }\n")
 	}
 	b.WriteString("}\n\n")
 
+	// Query methods are also listed at runtime so the client can call them with GET.
+	var queryMethods []string
+	for _, m := range methods {
+		if m.Query {
+			queryMethods = append(queryMethods, m.Name)
+		}
+	}
+	if len(queryMethods) > 0 {
+		b.WriteString("export const ")
+		b.WriteString(typeName)
+		b.WriteString("QueryMethods = ")
+		b.WriteString(emitStringTuple(queryMethods))
+		b.WriteString(" as const\n\n")
+	}
+
+	// Permission expressions let the frontend hide actions the user can't perform.
+	var permissioned []applets.TypedMethodDescription
+	for _, m := range methods {
+		if m.Permissions != nil {
+			permissioned = append(permissioned, m)
+		}
+	}
+	if len(permissioned) > 0 {
+		b.WriteString("export const ")
+		b.WriteString(typeName)
+		b.WriteString("Permissions = {\n")
+		for _, m := range permissioned {
+			expr, err := json.Marshal(m.Permissions)
+			if err != nil {
+				return "", fmt.Errorf("rpccodegen.EmitTypeScript: encode permissions of %q: %w", m.Name, err)
+			}
+			b.WriteString("  ")
+			b.WriteString(fmt.Sprintf("%q", m.Name))
+			b.WriteString(": ")
+			b.Write(expr)
+			b.WriteString(",\n")
+		}
+		b.WriteString("} as const\n\n")
+	}
+
+	if enc := desc.Encodings; enc != nil {
+		b.WriteString("export const ")
+		b.WriteString(typeName)
+		b.WriteString("Encodings = {\n  contentTypes: ")
+		b.WriteString(emitStringTuple(enc.ContentTypes))
+		b.WriteString(",\n  contentEncodings: ")
+		b.WriteString(emitStringTuple(enc.ContentEncodings))
+		b.WriteString(",\n} as const\n\n")
+	}
+
 	typeNames := make([]string, 0, len(desc.Types))
 	for name := range desc.Types {
 		typeNames = append(typeNames, name)
@@ -74,6 +154,161 @@ func EmitTypeScript(desc *applets.TypedRouterDescription, typeName string) (stri
 	return b.String(), nil
 }
 
+// EmitNamespaces generates a TypeScript namespace per dot-separated segment
+// of the method names, merged into typeName, so "chat.messages.send" is also
+// available as typeName.chat.messages.send. Segments that are not valid
+// identifiers are sanitized, e.g. "send@v2" becomes "send_v2"; methods whose
+// names sanitize to the same identifier are an error.
+func EmitNamespaces(desc *applets.TypedRouterDescription, typeName string) (string, error) {
+	if desc == nil {
+		return "", fmt.Errorf("rpccodegen.EmitNamespaces: description is nil")
+	}
+	typeName = strings.TrimSpace(typeName)
+	if typeName == "" {
+		return "", fmt.Errorf("rpccodegen.EmitNamespaces: type name is empty")
+	}
+
+	root := &tsNamespace{}
+	for _, m := range desc.Methods {
+		segments := strings.Split(m.Name, ".")
+		ns := root
+		for _, segment := range segments[:len(segments)-1] {
+			ns = ns.child(tsIdentifier(segment))
+		}
+		ident := tsIdentifier(segments[len(segments)-1])
+		for _, other := range ns.methods {
+			if other.ident == ident {
+				return "", fmt.Errorf("rpccodegen.EmitNamespaces: methods %q and %q both map to %q", other.name, m.Name, ident)
+			}
+		}
+		ns.methods = append(ns.methods, tsNamespaceMethod{ident: ident, name: m.Name})
+	}
+
+	var b strings.Builder
+	b.WriteString("export namespace ")
+	b.WriteString(typeName)
+	b.WriteString(" {\n")
+	root.emit(&b, typeName, "  ")
+	b.WriteString("}\n\n")
+	return b.String(), nil
+}
+
+type tsNamespace struct {
+	methods  []tsNamespaceMethod
+	names    []string
+	children map[string]*tsNamespace
+}
+
+type tsNamespaceMethod struct {
+	ident string
+	name  string
+}
+
+func (ns *tsNamespace) child(name string) *tsNamespace {
+	if ns.children == nil {
+		ns.children = make(map[string]*tsNamespace)
+	}
+	c, ok := ns.children[name]
+	if !ok {
+		c = &tsNamespace{}
+		ns.children[name] = c
+		ns.names = append(ns.names, name)
+	}
+	return c
+}
+
+func (ns *tsNamespace) emit(b *strings.Builder, typeName, indent string) {
+	sort.Slice(ns.methods, func(i, j int) bool { return ns.methods[i].name < ns.methods[j].name })
+	for _, m := range ns.methods {
+		b.WriteString(indent)
+		b.WriteString("export type ")
+		b.WriteString(m.ident)
+		b.WriteString(" = ")
+		b.WriteString(typeName)
+		b.WriteString("[")
+		b.WriteString(fmt.Sprintf("%q", m.name))
+		b.WriteString("]\n")
+	}
+	sort.Strings(ns.names)
+	for _, name := range ns.names {
+		b.WriteString(indent)
+		b.WriteString("export namespace ")
+		b.WriteString(name)
+		b.WriteString(" {\n")
+		ns.children[name].emit(b, typeName, indent+"  ")
+		b.WriteString(indent)
+		b.WriteString("}\n")
+	}
+}
+
+// tsReserved lists words that cannot name a type or namespace.
+var tsReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "enum": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true, "function": true,
+	"if": true, "import": true, "in": true, "instanceof": true, "new": true, "null": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true, "with": true,
+	"any": true, "boolean": true, "never": true, "number": true, "object": true, "string": true,
+	"symbol": true, "undefined": true, "unknown": true, "bigint": true,
+}
+
+// tsIdentifier turns a method name segment into a TypeScript identifier.
+func tsIdentifier(segment string) string {
+	var b strings.Builder
+	for i, r := range segment {
+		switch {
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	ident := b.String()
+	if ident == "" || tsReserved[ident] {
+		ident += "_"
+	}
+	return ident
+}
+
+// deprecatedDoc returns the @deprecated TSDoc tag for a method.
+func deprecatedDoc(m applets.TypedMethodDescription) string {
+	parts := []string{"@deprecated"}
+	if msg := strings.TrimSpace(m.DeprecationMessage); msg != "" {
+		parts = append(parts, strings.ReplaceAll(strings.Join(strings.Fields(msg), " "), "*/", "*\\/"))
+	}
+	if m.Sunset != "" {
+		parts = append(parts, "(sunset "+m.Sunset+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// emitErrorUnion returns the union of error shapes for the given codes.
+func emitErrorUnion(codes []string, details map[string]*applets.TypeRef) string {
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		if ref := details[code]; ref != nil {
+			parts[i] = fmt.Sprintf("{ code: %q; details: %s }", code, emitTypeRef(*ref))
+		} else {
+			parts[i] = fmt.Sprintf("{ code: %q }", code)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+func emitStringTuple(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
 func emitTypeRef(ref applets.TypeRef) string {
 	switch ref.Kind {
 	case "string":
@@ -134,6 +369,13 @@ func RunTypegen(root string, cfg Config, outputPath string) error {
 	if err != nil {
 		return err
 	}
+	if cfg.Namespaces {
+		namespaces, err := EmitNamespaces(desc, cfg.TypeName)
+		if err != nil {
+			return err
+		}
+		ts += namespaces
+	}
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
 		return err
 	}
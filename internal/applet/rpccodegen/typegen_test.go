@@ -140,6 +140,115 @@ func TestEmitTypeScript(t *testing.T) {
 				"age?: number",
 			},
 		},
+		{
+			name: "StreamMethod",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "chat.complete", Params: strRef, Result: applets.TypeRef{Kind: "named", Name: "ChatChunk"}, Stream: true},
+				},
+				Types: map[string]applets.TypedTypeObject{
+					"ChatChunk": {Fields: []applets.TypedField{{Name: "text", Type: strRef}}},
+				},
+			},
+			typeName: "ChatRPC",
+			wantContains: []string{
+				`"chat.complete": { params: string; result: AsyncIterable<ChatChunk>; stream: true }`,
+			},
+		},
+		{
+			name: "QueryMethod",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "dict.list", Params: strRef, Result: strRef, Query: true},
+					{Name: "dict.save", Params: strRef, Result: strRef},
+				},
+				Types: map[string]applets.TypedTypeObject{},
+			},
+			typeName: "DictRPC",
+			wantContains: []string{
+				`"dict.list": { params: string; result: string; query: true }`,
+				`"dict.save": { params: string; result: string }`,
+				`export const DictRPCQueryMethods = ["dict.list"] as const`,
+			},
+		},
+		{
+			name: "Encodings",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{{Name: "report.run", Params: strRef, Result: strRef}},
+				Types:   map[string]applets.TypedTypeObject{},
+				Encodings: &applets.TypedEncodings{
+					ContentTypes:     []string{"application/json", "application/msgpack"},
+					ContentEncodings: []string{"br", "gzip"},
+				},
+			},
+			typeName: "ReportRPC",
+			wantContains: []string{
+				"export const ReportRPCEncodings = {\n  contentTypes: [\"application/json\", \"application/msgpack\"],\n  contentEncodings: [\"br\", \"gzip\"],\n} as const",
+			},
+		},
+		{
+			name: "UploadMethod",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "sheet.import", Params: strRef, Result: strRef, Upload: &applets.TypedUploadDescription{AllowedTypes: []string{"text/csv"}}},
+				},
+				Types: map[string]applets.TypedTypeObject{},
+			},
+			typeName: "SheetRPC",
+			wantContains: []string{
+				`"sheet.import": { params: string; files: (File | Blob)[]; result: string }`,
+			},
+		},
+		{
+			name: "DeprecatedMethod",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "chat.send", Params: strRef, Result: strRef, Deprecated: true, DeprecationMessage: "Use chat.send@v2.", Sunset: "2027-01-31"},
+					{Name: "chat.send@v2", Params: strRef, Result: strRef, Version: "v2"},
+				},
+				Types: map[string]applets.TypedTypeObject{},
+			},
+			typeName: "ChatRPC",
+			wantContains: []string{
+				"  /** @deprecated Use chat.send@v2. (sunset 2027-01-31) */\n  \"chat.send\": { params: string; result: string }\n  \"chat.send@v2\": { params: string; result: string }\n",
+			},
+		},
+		{
+			name: "Permissions",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "chat.delete", Params: strRef, Result: strRef, Permissions: &applets.PermissionDescription{
+						Op: "anyOf",
+						Args: []applets.PermissionDescription{
+							{Op: "perm", Name: "Chat.ReadAll"},
+							{Op: "func", Name: "owner"},
+						},
+					}},
+					{Name: "chat.list", Params: strRef, Result: strRef},
+				},
+				Types: map[string]applets.TypedTypeObject{},
+			},
+			typeName: "ChatRPC",
+			wantContains: []string{
+				"export const ChatRPCPermissions = {\n  \"chat.delete\": {\"op\":\"anyOf\",\"args\":[{\"op\":\"perm\",\"name\":\"Chat.ReadAll\"},{\"op\":\"func\",\"name\":\"owner\"}]},\n} as const",
+			},
+		},
+		{
+			name: "Errors",
+			desc: &applets.TypedRouterDescription{
+				Methods: []applets.TypedMethodDescription{
+					{Name: "chat.send", Params: strRef, Result: strRef, Errors: []string{"quota_exceeded", "not_found"}},
+				},
+				Types: map[string]applets.TypedTypeObject{"QuotaDetails": {Fields: []applets.TypedField{{Name: "limit", Type: applets.TypeRef{Kind: "number"}}}}},
+				Errors: []applets.TypedErrorDescription{
+					{Code: "quota_exceeded", Message: "Quota exceeded.", Details: &applets.TypeRef{Kind: "named", Name: "QuotaDetails"}},
+				},
+			},
+			typeName: "ChatRPC",
+			wantContains: []string{
+				`"chat.send": { params: string; result: string; errors: { code: "quota_exceeded"; details: QuotaDetails } | { code: "not_found" } }`,
+			},
+		},
 		{
 			name:     "NilDescription",
 			desc:     nil,
@@ -171,3 +280,36 @@ func TestEmitTypeScript(t *testing.T) {
 		})
 	}
 }
+
+func TestEmitNamespaces(t *testing.T) {
+	t.Parallel()
+
+	strRef := applets.TypeRef{Kind: "string"}
+	desc := &applets.TypedRouterDescription{
+		Methods: []applets.TypedMethodDescription{
+			{Name: "chat.messages.send@v2", Params: strRef, Result: strRef},
+			{Name: "chat.delete", Params: strRef, Result: strRef},
+			{Name: "ping", Params: strRef, Result: strRef},
+		},
+	}
+	got, err := EmitNamespaces(desc, "ChatRPC")
+	require.NoError(t, err)
+	require.Equal(t, `export namespace ChatRPC {
+  export type ping = ChatRPC["ping"]
+  export namespace chat {
+    export type delete_ = ChatRPC["chat.delete"]
+    export namespace messages {
+      export type send_v2 = ChatRPC["chat.messages.send@v2"]
+    }
+  }
+}
+
+`, got)
+
+	_, err = EmitNamespaces(nil, "ChatRPC")
+	require.Error(t, err)
+
+	desc.Methods = append(desc.Methods, applets.TypedMethodDescription{Name: "chat.messages.send_v2", Params: strRef, Result: strRef})
+	_, err = EmitNamespaces(desc, "ChatRPC")
+	require.EqualError(t, err, `rpccodegen.EmitNamespaces: methods "chat.messages.send@v2" and "chat.messages.send_v2" both map to "send_v2"`)
+}
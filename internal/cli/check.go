@@ -48,7 +48,7 @@ func runCheck(cmd *cobra.Command, _ []string) error {
 	// RPC check for each applet (convention: router function is always "Router")
 	for _, name := range cfg.AppletNames() {
 		applet := cfg.Applets[name]
-		rpcCfg, err := rpccodegen.BuildRPCConfig(root, name, "Router")
+		rpcCfg, err := buildAppletRPCConfig(root, name, applet)
 		if err != nil {
 			cmd.PrintErrln("RPC check skipped for", name+":", err)
 			continue
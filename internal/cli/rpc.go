@@ -47,7 +47,7 @@ func NewRPCCheckCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			rpcCfg, err := rpccodegen.BuildRPCConfig(root, name, "Router")
+			rpcCfg, err := buildAppletRPCConfig(root, name, applet)
 			if err != nil {
 				return err
 			}
@@ -70,7 +70,7 @@ func NewRPCGenCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "gen",
 		Short:   "Generate RPC contract TypeScript from Go router",
-		Long:    `Generates rpc.generated.ts for the given applet. Requires --name.`,
+		Long:    `Generates rpc.generated.ts for the given applet. Requires --name. With [applets.<name>.rpc] namespaces = true, methods are also exposed as nested namespaces (chat.send -> <Type>.chat.send).`,
 		Example: `  applet rpc gen --name bichat`,
 		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, _ []string) error {
@@ -85,7 +85,7 @@ func NewRPCGenCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			rpcCfg, err := rpccodegen.BuildRPCConfig(root, name, "Router")
+			rpcCfg, err := buildAppletRPCConfig(root, name, applet)
 			if err != nil {
 				return err
 			}
@@ -126,7 +126,7 @@ func NewRPCWatchCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			rpcCfg, err := rpccodegen.BuildRPCConfig(root, name, "Router")
+			rpcCfg, err := buildAppletRPCConfig(root, name, applet)
 			if err != nil {
 				return err
 			}
@@ -172,6 +172,17 @@ func NewRPCWatchCommand() *cobra.Command {
 	return cmd
 }
 
+// buildAppletRPCConfig builds the codegen config for an applet, applying its
+// [applets.<name>.rpc] settings so gen, check and watch agree.
+func buildAppletRPCConfig(root, name string, applet *config.AppletConfig) (rpccodegen.Config, error) {
+	rpcCfg, err := rpccodegen.BuildRPCConfig(root, name, "Router")
+	if err != nil {
+		return rpccodegen.Config{}, err
+	}
+	rpcCfg.Namespaces = applet.RPC != nil && applet.RPC.Namespaces
+	return rpcCfg, nil
+}
+
 func runRPCGen(root, name string, applet *config.AppletConfig, rpcCfg rpccodegen.Config, cmd *cobra.Command) error {
 	targetAbs := filepath.Join(root, rpcCfg.TargetOut)
 	if err := rpccodegen.RunTypegen(root, rpcCfg, targetAbs); err != nil {
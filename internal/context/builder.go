@@ -9,27 +9,23 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
 	"github.com/iota-uz/applets/internal/api"
 	"github.com/iota-uz/applets/internal/router"
 	"github.com/iota-uz/applets/internal/security"
+	"github.com/iota-uz/applets/internal/tracing"
 	"github.com/iota-uz/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
 )
 
-// Identity holds the extracted user, tenant ID, and validated permissions.
-// Used by both ContextBuilder and StreamContextBuilder to avoid duplicating
-// the extraction + validation logic.
-type Identity struct {
-	User        api.AppletUser
-	TenantID    uuid.UUID
-	Permissions []string
-}
+// Identity holds the extracted user, tenant ID, validated permissions and
+// page locale. Used by ContextBuilder, StreamContextBuilder and the RPC
+// endpoint to avoid duplicating the extraction + validation logic.
+type Identity = api.Identity
 
-// ExtractIdentity extracts user, tenant ID, and permission names from the
-// request context via the provided HostServices. The caller supplies an
-// operation name (op) for error wrapping and an optional logger.
+// ExtractIdentity extracts user, tenant ID, permission names and page locale
+// from the request context via the provided HostServices. The caller supplies
+// an operation name (op) for error wrapping and an optional logger.
 func ExtractIdentity(ctx context.Context, host api.HostServices, op string, logger *logrus.Logger) (*Identity, error) {
 	user, err := host.ExtractUser(ctx)
 	if err != nil {
@@ -52,6 +48,7 @@ func ExtractIdentity(ctx context.Context, host api.HostServices, op string, logg
 		User:        user,
 		TenantID:    tenantID,
 		Permissions: permissions,
+		Locale:      host.ExtractPageLocale(ctx),
 	}, nil
 }
 
@@ -66,6 +63,7 @@ type ContextBuilder struct {
 	tenantNameResolver api.TenantNameResolver
 	errorEnricher      api.ErrorContextEnricher
 	sessionStore       api.SessionStore
+	tracer             api.Tracer
 
 	translationsMu    sync.RWMutex
 	translationsCache map[string]map[string]string
@@ -73,10 +71,12 @@ type ContextBuilder struct {
 
 // Ensure ContextBuilder implements api.ContextBuilderConfigurator.
 var _ api.ContextBuilderConfigurator = (*ContextBuilder)(nil)
+var _ api.TracerConfigurator = (*ContextBuilder)(nil)
 
 func (b *ContextBuilder) SetTenantNameResolver(r api.TenantNameResolver) { b.tenantNameResolver = r }
 func (b *ContextBuilder) SetErrorEnricher(e api.ErrorContextEnricher)    { b.errorEnricher = e }
 func (b *ContextBuilder) SetSessionStore(s api.SessionStore)             { b.sessionStore = s }
+func (b *ContextBuilder) SetTracer(t api.Tracer)                         { b.tracer = t }
 
 // NewContextBuilder creates a new ContextBuilder.
 func NewContextBuilder(
@@ -104,11 +104,23 @@ func NewContextBuilder(
 }
 
 // Build builds the InitialContext for the frontend.
-func (b *ContextBuilder) Build(ctx context.Context, r *http.Request, basePath string) (*api.InitialContext, error) {
+func (b *ContextBuilder) Build(ctx context.Context, r *http.Request, basePath string) (_ *api.InitialContext, err error) {
 	const op = "ContextBuilder.Build"
 	start := time.Now()
+	ctx, span := tracing.Start(ctx, b.tracer, "applet.context.build", nil)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 
-	id, err := ExtractIdentity(ctx, b.host, op, b.logger)
+	idCtx, idSpan := tracing.Start(ctx, b.tracer, "applet.context.extract_identity", nil)
+	id, err := ExtractIdentity(idCtx, b.host, op, b.logger)
+	if err != nil {
+		idSpan.RecordError(err)
+	}
+	idSpan.End()
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +129,10 @@ func (b *ContextBuilder) Build(ctx context.Context, r *http.Request, basePath st
 	tenantID := id.TenantID
 	permissions := id.Permissions
 
-	userLocale := b.host.ExtractPageLocale(ctx)
+	userLocale := id.Locale
+	_, trSpan := tracing.Start(ctx, b.tracer, "applet.context.translations", map[string]string{"locale": userLocale.String()})
 	translations := b.getAllTranslations(userLocale)
+	trSpan.End()
 	tenantName := b.getTenantName(ctx, tenantID)
 	routeRouter := b.config.Router
 	if routeRouter == nil {
@@ -182,7 +196,12 @@ func (b *ContextBuilder) Build(ctx context.Context, r *http.Request, basePath st
 	}
 
 	if b.config.CustomContext != nil {
-		customData, err := b.config.CustomContext(ctx)
+		customCtx, customSpan := tracing.Start(ctx, b.tracer, "applet.context.custom", nil)
+		customData, err := b.config.CustomContext(customCtx)
+		if err != nil {
+			customSpan.RecordError(err)
+		}
+		customSpan.End()
 		if err != nil && b.logger != nil {
 			b.logger.WithError(err).Warn("Failed to build custom context")
 		} else if customData != nil {
@@ -90,3 +90,61 @@ func TestBuild_EmptyRPCEndpointWhenRPCDisabled(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, initial.Config.RPCUIEndpoint)
 }
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]string
+	ended bool
+}
+
+func (s *recordingSpan) SetAttribute(key, value string) { s.attrs[key] = value }
+func (s *recordingSpan) RecordError(error)              {}
+func (s *recordingSpan) End()                           { s.ended = true }
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, api.Span) {
+	s := &recordingSpan{name: name, attrs: map[string]string{}}
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestBuild_Tracing(t *testing.T) {
+	t.Parallel()
+
+	tracer := &recordingTracer{}
+	builder := NewContextBuilder(
+		api.Config{
+			WindowGlobal:  "__T__",
+			Shell:         api.ShellConfig{Mode: api.ShellModeStandalone},
+			CustomContext: func(context.Context) (map[string]interface{}, error) { return nil, nil },
+		},
+		nil,
+		api.DefaultSessionConfig,
+		nil,
+		nil,
+		&builderTestHost{},
+		api.WithTracer(tracer),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/bi-chat", nil)
+	_, err := builder.Build(context.Background(), req, "/bi-chat")
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(tracer.spans))
+	for _, s := range tracer.spans {
+		names = append(names, s.name)
+		assert.True(t, s.ended, s.name)
+	}
+	assert.Equal(t, []string{
+		"applet.context.build",
+		"applet.context.extract_identity",
+		"applet.context.translations",
+		"applet.context.custom",
+	}, names)
+}
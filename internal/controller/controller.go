@@ -9,6 +9,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/iota-uz/applets/internal/api"
 	"github.com/iota-uz/applets/internal/context"
+	"github.com/iota-uz/applets/internal/idempotency"
 	"github.com/iota-uz/applets/internal/validate"
 	"github.com/iota-uz/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
@@ -23,10 +24,37 @@ type Controller struct {
 	assetsBasePath string
 	resolvedAssets *api.ResolvedAssets
 	devAssets      *api.DevAssetConfig
+	metrics        api.MetricsRecorder
+	tracer         api.Tracer
+	auditSink      api.AuditSink
+	// idempotency is used when RPCConfig.IdempotencyStore is not set.
+	idempotency api.IdempotencyStore
+	// wsTickets authorize RPC WebSocket upgrades; see handleRPCWebSocketTicket.
+	wsTickets wsTickets
 }
 
 var _ api.AppletController = (*Controller)(nil)
 
+// Controller receives the builder options passed to New: context builder
+// settings are forwarded to its builder, the rest configure the controller.
+var (
+	_ api.ContextBuilderConfigurator = (*Controller)(nil)
+	_ api.TracerConfigurator         = (*Controller)(nil)
+	_ api.AuditSinkConfigurator      = (*Controller)(nil)
+)
+
+func (c *Controller) SetTenantNameResolver(r api.TenantNameResolver) {
+	c.builder.SetTenantNameResolver(r)
+}
+func (c *Controller) SetErrorEnricher(e api.ErrorContextEnricher) { c.builder.SetErrorEnricher(e) }
+func (c *Controller) SetSessionStore(s api.SessionStore)          { c.builder.SetSessionStore(s) }
+func (c *Controller) SetAuditSink(s api.AuditSink)                { c.auditSink = s }
+
+func (c *Controller) SetTracer(t api.Tracer) {
+	c.tracer = t
+	c.builder.SetTracer(t)
+}
+
 // New creates a new Controller for the given applet.
 func New(
 	applet api.Applet,
@@ -50,16 +78,23 @@ func New(
 		logger = logrus.StandardLogger()
 	}
 	cfg := applet.Config()
-	builder := context.NewContextBuilder(cfg, bundle, sessionConfig, logger, metrics, host, opts...)
 	c := &Controller{
-		applet:  applet,
-		builder: builder,
-		logger:  logger,
-		host:    host,
+		applet:      applet,
+		builder:     context.NewContextBuilder(cfg, bundle, sessionConfig, logger, metrics, host),
+		logger:      logger,
+		host:        host,
+		metrics:     metrics,
+		idempotency: idempotency.NewMemoryStore(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	if err := c.initAssets(); err != nil {
 		return nil, fmt.Errorf("controller: %w", err)
 	}
+	if cfg.RPC != nil && cfg.RPC.Replayer != nil && c.devAssets == nil {
+		logger.WithField("applet", applet.Name()).Error("RPCConfig.Replayer is set but the dev proxy is disabled; ignoring it and running handlers. Replaying recorded responses bypasses permission checks and is only honored in development")
+	}
 	return c, nil
 }
 
@@ -118,6 +153,11 @@ func (c *Controller) registerAppRoutes(router *mux.Router, routePatterns []strin
 		}
 		router.HandleFunc(p, c.RenderApp).Methods(http.MethodGet, http.MethodHead)
 	}
+	if rpcCfg := c.applet.Config().RPC; rpcCfg != nil {
+		if rpcCfg.Describe != nil && c.devAssets != nil {
+			router.HandleFunc(rpcPlaygroundPath, c.handleRPCPlayground).Methods(http.MethodGet)
+		}
+	}
 	router.HandleFunc("", c.RenderApp).Methods(http.MethodGet, http.MethodHead)
 	router.HandleFunc("/", c.RenderApp).Methods(http.MethodGet, http.MethodHead)
 	router.PathPrefix("/").HandlerFunc(c.RenderApp).Methods(http.MethodGet, http.MethodHead)
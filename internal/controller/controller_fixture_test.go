@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// testControllerOptions holds what newTestController varies between tests.
+type testControllerOptions struct {
+	config  api.Config
+	metrics api.MetricsRecorder
+}
+
+type testControllerOption func(*testControllerOptions)
+
+// withTestRPC sets the applet's RPC config.
+func withTestRPC(rpcCfg *api.RPCConfig) testControllerOption {
+	return func(o *testControllerOptions) { o.config.RPC = rpcCfg }
+}
+
+// withTestAssets replaces the default dev proxy assets.
+func withTestAssets(assets api.AssetConfig) testControllerOption {
+	return func(o *testControllerOptions) { o.config.Assets = assets }
+}
+
+// withTestPermissions sets the applet-wide permission expression.
+func withTestPermissions(expr api.PermissionExpr) testControllerOption {
+	return func(o *testControllerOptions) { o.config.Permissions = expr }
+}
+
+// withTestMetrics sets the controller's MetricsRecorder.
+func withTestMetrics(metrics api.MetricsRecorder) testControllerOption {
+	return func(o *testControllerOptions) { o.metrics = metrics }
+}
+
+// newTestController builds a controller for a standalone applet "t" at /t
+// with the dev proxy enabled.
+func newTestController(t testing.TB, opts ...testControllerOption) *Controller {
+	t.Helper()
+	o := testControllerOptions{config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+	}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c, err := New(&testApplet{name: "t", basePath: "/t", config: o.config}, nil, api.DefaultSessionConfig, nil, o.metrics, &testHostServices{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
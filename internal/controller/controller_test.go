@@ -2,21 +2,35 @@ package controller
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"testing/fstest"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/iota-uz/applets/internal/api"
+	"github.com/iota-uz/applets/internal/recording"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
 )
 
 type countingFS struct {
@@ -344,6 +358,57 @@ func TestAppletController_RPC(t *testing.T) {
 			wantHTTP:     http.StatusRequestEntityTooLarge,
 			wantRPCError: "payload_too_large",
 		},
+		{
+			name: "MethodRaisesBodyLimit",
+			rpcCfg: &api.RPCConfig{
+				Path:         "/rpc",
+				MaxBodyBytes: 32,
+				Methods: map[string]api.RPCMethod{
+					"import": {MaxBodyBytes: 256, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return map[string]any{"ok": true}, nil }},
+				},
+			},
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"import","params":{"x":"this is too long"}}`))
+				r.Host = "example.com"
+				return r
+			},
+			wantHTTP:      http.StatusOK,
+			wantResultKey: "ok",
+		},
+		{
+			name: "MethodLowersBodyLimit",
+			rpcCfg: &api.RPCConfig{
+				Path: "/rpc",
+				Methods: map[string]api.RPCMethod{
+					"ping":   {MaxBodyBytes: 48, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "pong", nil }},
+					"import": {MaxBodyBytes: 256, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				},
+			},
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"ping","params":{"x":"this is too long"}}`))
+				r.Host = "example.com"
+				return r
+			},
+			wantHTTP:     http.StatusRequestEntityTooLarge,
+			wantRPCError: "payload_too_large",
+		},
+		{
+			name: "BatchIgnoresMethodBodyLimit",
+			rpcCfg: &api.RPCConfig{
+				Path:         "/rpc",
+				MaxBodyBytes: 32,
+				Methods: map[string]api.RPCMethod{
+					"import": {MaxBodyBytes: 256, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				},
+			},
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`[{"id":"1","method":"import","params":{"x":"this is too long"}}]`))
+				r.Host = "example.com"
+				return r
+			},
+			wantHTTP:     http.StatusRequestEntityTooLarge,
+			wantRPCError: "payload_too_large",
+		},
 	}
 
 	for _, tc := range cases {
@@ -406,3 +471,1799 @@ func TestRequirePermissions_Allows(t *testing.T) {
 	require.NoError(t, err)
 	require.NoError(t, c.requirePermissions(ctx, []string{"test.secret"}))
 }
+
+func TestAppletController_RPCBatch(t *testing.T) {
+	t.Parallel()
+
+	methods := map[string]api.RPCMethod{
+		"echo": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+			var p map[string]any
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return p, nil
+		}},
+		"fail": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+			return nil, fmt.Errorf("fail: %w", api.ErrNotFound)
+		}},
+		"secret": {
+			RequirePermissions: []string{"test.secret"},
+			Handler:            func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil },
+		},
+	}
+
+	t.Run("ResponsesInRequestOrder", func(t *testing.T) {
+		t.Parallel()
+
+		for _, concurrency := range []int{0, 4} {
+			c := newTestController(t, withTestRPC(&api.RPCConfig{Path: "/rpc", BatchConcurrency: concurrency, Methods: methods}))
+			body := `[
+				{"id":"1","method":"echo","params":{"n":1}},
+				{"id":"2","method":"fail","params":{}},
+				{"id":"3","method":"missing","params":{}},
+				{"id":"4","method":"secret","params":{}},
+				{"id":"5","method":"","params":{}},
+				{"id":"6","method":"echo","params":{"n":6}}
+			]`
+			req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			c.handleRPC(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var resps []rpcResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resps))
+			require.Len(t, resps, 6)
+			for i, resp := range resps {
+				assert.Equal(t, fmt.Sprint(i+1), resp.ID)
+			}
+			assert.Nil(t, resps[0].Error)
+			assert.Equal(t, map[string]any{"n": float64(1)}, resps[0].Result)
+			assert.Equal(t, "not_found", resps[1].Error.Code)
+			assert.Equal(t, "method_not_found", resps[2].Error.Code)
+			assert.Equal(t, "forbidden", resps[3].Error.Code)
+			assert.Equal(t, "invalid_request", resps[4].Error.Code)
+			assert.Equal(t, map[string]any{"n": float64(6)}, resps[5].Result)
+		}
+	})
+
+	t.Run("EmptyBatchRejected", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(&api.RPCConfig{Path: "/rpc", Methods: methods}))
+		req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(` [] `))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid_request", resp.Error.Code)
+	})
+
+	t.Run("BatchTooLarge", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(&api.RPCConfig{Path: "/rpc", MaxBatchSize: 1, Methods: methods}))
+		req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`[{"id":"1","method":"echo"},{"id":"2","method":"echo"}]`))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid_request", resp.Error.Code)
+		assert.Contains(t, resp.Error.Message, "batch exceeds 1 calls")
+	})
+}
+
+func TestAppletController_RPCValidationDetails(t *testing.T) {
+	t.Parallel()
+
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"create": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return nil, &api.ValidationError{Fields: []api.FieldError{{Field: "name", Rule: "required", Message: "is required"}}}
+				}},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"create","params":{}}`))
+	w := httptest.NewRecorder()
+	c.handleRPC(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details struct {
+				Message string           `json:"message"`
+				Fields  []api.FieldError `json:"fields"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "validation", resp.Error.Code)
+	assert.Equal(t, "validation failed", resp.Error.Message)
+	assert.Empty(t, resp.Error.Details.Message, "internal details must stay hidden")
+	assert.Equal(t, []api.FieldError{{Field: "name", Rule: "required", Message: "is required"}}, resp.Error.Details.Fields)
+}
+
+func TestAppletController_RPCStream(t *testing.T) {
+	t.Parallel()
+
+	rpcCfg := &api.RPCConfig{
+		Path: "/rpc",
+		Methods: map[string]api.RPCMethod{
+			"count": {Stream: func(ctx context.Context, params json.RawMessage, emit func(event any) error) error {
+				for i := 1; i <= 2; i++ {
+					if err := emit(map[string]int{"n": i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}},
+			"broken": {Stream: func(ctx context.Context, params json.RawMessage, emit func(event any) error) error {
+				if err := emit(map[string]int{"n": 1}); err != nil {
+					return err
+				}
+				return fmt.Errorf("broken: %w", api.ErrNotFound)
+			}},
+			"secret": {
+				RequirePermissions: []string{"test.secret"},
+				Stream:             func(ctx context.Context, params json.RawMessage, emit func(event any) error) error { return nil },
+			},
+		},
+	}
+
+	t.Run("EmitsEventsThenDone", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(rpcCfg))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"count","params":{}}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, "event: result\ndata: {\"n\":1}\n\nevent: result\ndata: {\"n\":2}\n\nevent: done\ndata: \n\n", w.Body.String())
+	})
+
+	t.Run("ErrorEvent", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(rpcCfg))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"broken","params":{}}`)))
+		assert.Contains(t, w.Body.String(), "event: error\ndata: {\"code\":\"not_found\",\"message\":\"resource not found\"}\n\n")
+		assert.NotContains(t, w.Body.String(), "event: done")
+	})
+
+	t.Run("PermissionDeniedBeforeStream", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(rpcCfg))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"secret","params":{}}`)))
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "forbidden", resp.Error.Code)
+	})
+
+	t.Run("NotBatchable", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestController(t, withTestRPC(rpcCfg))
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`[{"id":"1","method":"count","params":{}}]`)))
+		var resps []rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resps))
+		require.Len(t, resps, 1)
+		require.NotNil(t, resps[0].Error)
+		assert.Equal(t, "invalid_request", resps[0].Error.Code)
+	})
+}
+
+type denyLimiter struct {
+	keys []api.RateLimitKey
+}
+
+func (l *denyLimiter) Allow(_ context.Context, key api.RateLimitKey) (api.RateLimitDecision, error) {
+	l.keys = append(l.keys, key)
+	return api.RateLimitDecision{Allowed: false, RetryAfter: 1500 * time.Millisecond}, nil
+}
+
+func TestAppletController_RPCRateLimited(t *testing.T) {
+	t.Parallel()
+
+	limiter := &denyLimiter{}
+	tenantID := uuid.New()
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"free":    {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				"limited": {RateLimiter: limiter, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), testUserKey, api.AppletUser(&mockUser{id: 7}))
+	ctx = context.WithValue(ctx, testTenantIDKey, tenantID)
+
+	w := httptest.NewRecorder()
+	c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"free","params":{}}`)).WithContext(ctx))
+	var resp rpcResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Error)
+
+	w = httptest.NewRecorder()
+	c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"2","method":"limited","params":{}}`)).WithContext(ctx))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	resp = rpcResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "rate_limited", resp.Error.Code)
+	assert.Equal(t, map[string]any{"retryAfterMs": float64(1500)}, resp.Error.Details)
+	assert.Equal(t, []api.RateLimitKey{{UserID: 7, TenantID: tenantID.String(), Method: "limited"}}, limiter.keys)
+}
+
+func TestAppletController_RPCIdempotency(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	fail := true
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"orders.create": {Idempotent: true, Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					calls++
+					if fail {
+						return nil, api.ErrInvalid
+					}
+					return map[string]any{"order": calls}, nil
+				}},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), testUserKey, api.AppletUser(&mockUser{id: 7}))
+
+	call := func(id, body string) (*httptest.ResponseRecorder, rpcResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body)).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", "abc")
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, id, resp.ID)
+		return w, resp
+	}
+
+	_, resp := call("1", `{"id":"1","method":"orders.create","params":{}}`)
+	require.NotNil(t, resp.Error, "failed calls are not stored")
+
+	fail = false
+	w, resp := call("2", `{"id":"2","method":"orders.create","params":{}}`)
+	require.Nil(t, resp.Error)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, map[string]any{"order": float64(2)}, resp.Result)
+
+	w, resp = call("3", `{"id":"3","method":"orders.create","params":{}}`)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, map[string]any{"order": float64(2)}, resp.Result)
+	assert.Equal(t, 2, calls, "replayed calls do not run the handler")
+
+	_, resp = call("5", `{"id":"5","method":"orders.create","params":{"qty":2}}`)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "conflict", resp.Error.Code, "a key is bound to its params")
+	assert.Equal(t, 2, calls)
+
+	anon := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"6","method":"orders.create","params":{}}`))
+	anon.Header.Set("Idempotency-Key", "abc")
+	anonW := httptest.NewRecorder()
+	c.handleRPC(anonW, anon)
+	assert.Empty(t, anonW.Header().Get("Idempotent-Replayed"), "anonymous calls are not replayed")
+	assert.Equal(t, 3, calls)
+
+	status, _, err := c.idempotency.Reserve(ctx, ":7:orders.create:pending", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, api.IdempotencyNew, status)
+	_, resp = call("4", `{"id":"4","method":"orders.create","params":{},"idempotencyKey":"pending"}`)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "conflict", resp.Error.Code)
+}
+
+func TestAppletController_RPCIdempotencyOutlivesTimeout(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c := newTestController(t, withTestRPC(&api.RPCConfig{
+		Path: "/rpc",
+		Methods: map[string]api.RPCMethod{
+			"orders.create": {Idempotent: true, Timeout: 10 * time.Millisecond, Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+				calls.Add(1)
+				<-release // ignores cancellation
+				return "created", nil
+			}},
+		},
+	}))
+	ctx := context.WithValue(context.Background(), testUserKey, api.AppletUser(&mockUser{id: 7}))
+	call := func() (*httptest.ResponseRecorder, rpcResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"orders.create","params":{}}`)).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", "abc")
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w, resp
+	}
+
+	_, resp := call()
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "timeout", resp.Error.Code)
+
+	_, resp = call()
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "conflict", resp.Error.Code, "the key stays reserved while the handler runs")
+
+	// The caller was told the first call timed out, so its late success is
+	// not replayed: once the handler returns, the key is free for a retry.
+	close(release)
+	require.Eventually(t, func() bool {
+		w, resp := call()
+		return resp.Error == nil && w.Header().Get("Idempotent-Replayed") == "" && resp.Result == "created"
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestAppletController_RPCTimeout(t *testing.T) {
+	t.Parallel()
+
+	deadlines := make(chan time.Time, 2)
+	block := func(ctx context.Context, params json.RawMessage) (any, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		<-ctx.Done()
+		return nil, errors.New("query aborted")
+	}
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path:    "/rpc",
+			Timeout: time.Hour,
+			Methods: map[string]api.RPCMethod{
+				"slow":    {Timeout: 10 * time.Millisecond, Handler: block},
+				"default": {Handler: block},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	t.Run("Timeout", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"slow","params":{}}`)))
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "timeout", resp.Error.Code)
+		assert.WithinDuration(t, time.Now(), <-deadlines, time.Second)
+	})
+
+	t.Run("ClientCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"default","params":{}}`)).WithContext(ctx))
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "canceled", resp.Error.Code)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), <-deadlines, time.Minute, "config timeout applies by default")
+	})
+}
+
+type recordedMetric struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	durations []recordedMetric
+	counters  []recordedMetric
+	values    []recordedMetric
+}
+
+func (m *recordingMetrics) RecordDuration(name string, _ time.Duration, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.durations = append(m.durations, recordedMetric{name: name, labels: labels})
+}
+
+func (m *recordingMetrics) IncrementCounter(name string, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, recordedMetric{name: name, labels: labels})
+}
+
+func (m *recordingMetrics) RecordValue(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values = append(m.values, recordedMetric{name: name, labels: labels, value: value})
+}
+
+func TestAppletController_RPCMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := &recordingMetrics{}
+	tenantID := uuid.New()
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"ok":   {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				"fail": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return nil, api.ErrNotFound }},
+				"quota": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return nil, &api.CodedError{Code: "quota_exceeded", Message: "Quota exceeded."}
+				}},
+				"locked": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return nil, &api.CodedError{Code: "conversation_locked", Message: "Conversation is locked."}
+				}},
+			},
+			ErrorCodes: []string{"quota_exceeded"},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, metrics, &testHostServices{})
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), testTenantIDKey, tenantID)
+
+	body := `[{"id":"1","method":"ok"},{"id":"2","method":"fail"},{"id":"3","method":"nope-123"},{"id":"4","method":"quota"},{"id":"5","method":"locked"}]`
+	w := httptest.NewRecorder()
+	c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body)).WithContext(ctx))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	labels := func(method, code string) map[string]string {
+		return map[string]string{"applet": "t", "method": method, "code": code, "tenant_id": tenantID.String()}
+	}
+	want := []recordedMetric{
+		{name: "applet.rpc.calls", labels: labels("ok", "ok")},
+		{name: "applet.rpc.calls", labels: labels("fail", "not_found")},
+		{name: "applet.rpc.calls", labels: labels("unknown", "method_not_found")},
+		{name: "applet.rpc.calls", labels: labels("quota", "quota_exceeded")},
+		{name: "applet.rpc.calls", labels: labels("locked", "other")},
+	}
+	assert.Equal(t, want, metrics.counters)
+	assert.Len(t, metrics.durations, 5)
+	assert.Equal(t, []recordedMetric{
+		{name: "applet.rpc.request_bytes", labels: map[string]string{"applet": "t", "method": "batch"}, value: float64(len(body))},
+		{name: "applet.rpc.response_bytes", labels: map[string]string{"applet": "t", "method": "batch"}, value: float64(w.Body.Len())},
+	}, metrics.values)
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]string
+	err   error
+	ended bool
+}
+
+func (s *recordingSpan) SetAttribute(key, value string) { s.attrs[key] = value }
+func (s *recordingSpan) RecordError(err error)          { s.err = err }
+func (s *recordingSpan) End()                           { s.ended = true }
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, api.Span) {
+	s := &recordingSpan{name: name, attrs: map[string]string{}}
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestAppletController_RPCTracing(t *testing.T) {
+	t.Parallel()
+
+	tracer := &recordingTracer{}
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"ok":   {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				"fail": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return nil, api.ErrNotFound }},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{}, api.WithTracer(tracer))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`[{"id":"1","method":"ok"},{"id":"2","method":"fail"}]`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Len(t, tracer.spans, 2)
+	ok, fail := tracer.spans[0], tracer.spans[1]
+	assert.Equal(t, "applet.rpc", ok.name)
+	assert.Equal(t, map[string]string{"applet.name": "t", "rpc.method": "ok"}, ok.attrs)
+	assert.NoError(t, ok.err)
+	assert.True(t, ok.ended)
+	assert.Equal(t, map[string]string{"applet.name": "t", "rpc.method": "fail", "rpc.error_code": "not_found"}, fail.attrs)
+	assert.Error(t, fail.err)
+	assert.True(t, fail.ended)
+}
+
+func TestAppletController_RPCQuery(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"dict.get": {Query: true, CacheControl: "private, max-age=60", Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					calls++
+					var p struct {
+						Key string `json:"key"`
+					}
+					if err := json.Unmarshal(params, &p); err != nil {
+						return nil, err
+					}
+					return map[string]string{"key": p.Key, "value": "<v>"}, nil
+				}},
+				"dict.save": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+				"dict.public": {Query: true, CacheControl: "public, max-age=300", Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return "v", nil
+				}},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		return w
+	}
+
+	w := get(`/t/rpc?method=dict.get&params=%7B%22key%22%3A%22a%22%7D`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+	var resp rpcResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, map[string]any{"key": "a", "value": "<v>"}, resp.Result)
+
+	w = get(`/t/rpc?method=dict.get&params=%7B%22key%22%3A%22a%22%7D`, `"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, []string{"Accept, Accept-Encoding"}, w.Header().Values("Vary"), "304 varies like the 200")
+
+	w = get(`/t/rpc?method=dict.get&params=%7B%22key%22%3A%22b%22%7D`, etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, 3, calls)
+
+	w = get(`/t/rpc?method=dict.save`, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = get(`/t/rpc?method=dict.get&params=%7Bbad`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = get(`/t/rpc?method=dict.public`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"), "anonymous responses may be shared")
+
+	userCtx := context.WithValue(context.Background(), testUserKey, api.AppletUser(&mockUser{id: 1}))
+	req := httptest.NewRequest(http.MethodGet, `/t/rpc?method=dict.public`, nil).WithContext(userCtx)
+	w = httptest.NewRecorder()
+	c.handleRPC(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"), "per-user responses never reach shared caches")
+	assert.Equal(t, []string{"Cookie", "Accept, Accept-Encoding"}, w.Header().Values("Vary"))
+
+	req = httptest.NewRequest(http.MethodGet, `/t/rpc?method=dict.public`, nil).WithContext(userCtx)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	c.handleRPC(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, []string{"Cookie", "Accept, Accept-Encoding"}, w.Header().Values("Vary"))
+}
+
+func TestPrivateCacheControl(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "private, max-age=60", privateCacheControl("public, max-age=60, s-maxage=600"))
+	assert.Equal(t, "private, no-cache", privateCacheControl("private, no-cache"))
+	assert.Equal(t, "no-store", privateCacheControl("public, no-store"))
+}
+
+// prefixCodec is a stand-in binary codec: JSON with a marker prefix.
+type prefixCodec struct{}
+
+func (prefixCodec) ContentType() string { return "application/x-test" }
+
+func (prefixCodec) Marshal(v any) ([]byte, error) {
+	if _, ok := v.(map[string]any)["result"].(map[string]any)["n"].(int64); !ok {
+		return nil, errors.New("integers must be int64")
+	}
+	data, err := json.Marshal(v)
+	return append([]byte("X"), data...), err
+}
+
+func (prefixCodec) Unmarshal(data []byte, v any) error {
+	if !bytes.HasPrefix(data, []byte("X")) {
+		return errors.New("missing prefix")
+	}
+	return json.Unmarshal(data[1:], v)
+}
+
+func TestAppletController_RPCEncoding(t *testing.T) {
+	t.Parallel()
+
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path:                 "/rpc",
+			MaxBodyBytes:         256,
+			CompressionThreshold: 64,
+			Codecs:               []api.RPCCodec{prefixCodec{}},
+			Methods: map[string]api.RPCMethod{
+				"echo": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					var p struct {
+						Text string `json:"text"`
+					}
+					if err := json.Unmarshal(params, &p); err != nil {
+						return nil, err
+					}
+					return map[string]any{"n": 1, "text": p.Text}, nil
+				}},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	gz := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(s))
+		_ = zw.Close()
+		return &buf
+	}
+	post := func(body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/t/rpc", body)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		c.handleRPC(w, req)
+		return w
+	}
+
+	t.Run("CodecRoundTrip", func(t *testing.T) {
+		w := post(bytes.NewBufferString(`X{"id":"1","method":"echo","params":{"text":"hi"}}`), map[string]string{"Content-Type": "application/x-test"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-test", w.Header().Get("Content-Type"))
+		assert.Equal(t, `X{"id":"1","result":{"n":1,"text":"hi"}}`, w.Body.String())
+	})
+
+	t.Run("AcceptOverridesRequestCodec", func(t *testing.T) {
+		w := post(bytes.NewBufferString(`X{"id":"1","method":"echo","params":{"text":"hi"}}`), map[string]string{
+			"Content-Type": "application/x-test",
+			"Accept":       "application/json, application/x-test;q=0.5",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("GzipBothWays", func(t *testing.T) {
+		text := strings.Repeat("a", 100)
+		w := post(gz(`{"id":"1","method":"echo","params":{"text":"`+text+`"}}`), map[string]string{
+			"Content-Encoding": "gzip",
+			"Accept-Encoding":  "br;q=1, gzip;q=0.8",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		zr, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		var resp rpcResponse
+		require.NoError(t, json.NewDecoder(zr).Decode(&resp))
+		assert.Equal(t, map[string]any{"n": float64(1), "text": text}, resp.Result)
+	})
+
+	t.Run("SmallResponsesUncompressed", func(t *testing.T) {
+		w := post(bytes.NewBufferString(`{"id":"1","method":"echo","params":{"text":"hi"}}`), map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("LimitAppliesAfterDecompression", func(t *testing.T) {
+		body := gz(`{"id":"1","method":"echo","params":{"text":"` + strings.Repeat("a", 1000) + `"}}`)
+		require.Less(t, body.Len(), 256)
+		w := post(body, map[string]string{"Content-Encoding": "gzip"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("UnsupportedEncoding", func(t *testing.T) {
+		w := post(bytes.NewBufferString(`{}`), map[string]string{"Content-Encoding": "zstd"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		w = post(bytes.NewBufferString(`{}`), map[string]string{"Content-Type": "application/xml"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestAppletController_RPCDeprecated(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"chat.send": {Handler: handler, Deprecated: &api.Deprecation{
+					Message: "Use chat.send@v2.",
+					Sunset:  time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC),
+				}},
+				"chat.send@v2": {Handler: handler},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := post(`{"id":"1","method":"chat.send","params":{}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Sun, 31 Jan 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+
+	w = post(`{"id":"1","method":"chat.send@v2","params":{}}`)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	w = post(`[{"id":"1","method":"chat.send@v2"},{"id":"2","method":"chat.send"}]`)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+}
+
+type recordingAuditSink struct {
+	mu     sync.Mutex
+	events []api.AuditEvent
+}
+
+func (s *recordingAuditSink) Record(_ context.Context, ev api.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func TestAppletController_RPCAudit(t *testing.T) {
+	t.Parallel()
+
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"user.delete": {
+					Audit: true,
+					AuditParams: func(params json.RawMessage) any {
+						return map[string]any{"redacted": true}
+					},
+					Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+						return nil, fmt.Errorf("boom: %w", api.ErrPermissionDenied)
+					},
+				},
+				"user.get": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+			},
+		},
+	}}
+	sink := &recordingAuditSink{}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{}, api.WithAuditSink(sink))
+	require.NoError(t, err)
+
+	tenantID := uuid.New()
+	post := func(body, requestID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body))
+		ctx := context.WithValue(r.Context(), testUserKey, api.AppletUser(&mockUser{id: 42}))
+		ctx = context.WithValue(ctx, testTenantIDKey, tenantID)
+		if requestID != "" {
+			r.Header.Set("X-Request-ID", requestID)
+		}
+		w := httptest.NewRecorder()
+		c.handleRPC(w, r.WithContext(ctx))
+		return w
+	}
+
+	w := post(`{"id":"1","method":"user.delete","params":{"id":7}}`, "req-1")
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+	post(`{"id":"2","method":"user.get"}`, "")
+
+	require.Len(t, sink.events, 1)
+	ev := sink.events[0]
+	assert.Equal(t, "req-1", ev.RequestID)
+	assert.Equal(t, uint(42), ev.UserID)
+	assert.Equal(t, tenantID.String(), ev.TenantID)
+	assert.Equal(t, "user.delete", ev.Method)
+	assert.Equal(t, "forbidden", ev.Code)
+	assert.Equal(t, map[string]any{"redacted": true}, ev.Params)
+	assert.False(t, ev.Time.IsZero())
+
+	w = post(`{"id":"3","method":"user.get"}`, "")
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+}
+
+func TestAppletController_PermissionExpr(t *testing.T) {
+	t.Parallel()
+
+	isOwner := func(_ context.Context, u api.AppletUser, params json.RawMessage) (bool, error) {
+		var p struct {
+			OwnerID uint `json:"ownerId"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return false, err
+		}
+		return p.OwnerID == u.ID(), nil
+	}
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		Permissions:  api.Not(api.Perm("Applet.Blocked")),
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"chat.read": {
+					Permissions: api.AnyOf(api.Perm("Chat.ReadAll"), api.Func("owner", isOwner)),
+					Handler:     func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil },
+				},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	withUser := func(r *http.Request, u *mockUser) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), testUserKey, api.AppletUser(u)))
+	}
+	call := func(u *mockUser, params string) *rpcError {
+		body := `{"id":"1","method":"chat.read","params":` + params + `}`
+		w := httptest.NewRecorder()
+		c.handleRPC(w, withUser(httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body)), u))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Error
+	}
+
+	assert.Nil(t, call(&mockUser{id: 1, permissions: []string{"Chat.ReadAll"}}, `{"ownerId":2}`))
+	assert.Nil(t, call(&mockUser{id: 2}, `{"ownerId":2}`))
+	if rpcErr := call(&mockUser{id: 3}, `{"ownerId":2}`); assert.NotNil(t, rpcErr) {
+		assert.Equal(t, "forbidden", rpcErr.Code)
+	}
+	if rpcErr := call(&mockUser{id: 3}, `"bad"`); assert.NotNil(t, rpcErr) {
+		assert.NotEqual(t, "forbidden", rpcErr.Code)
+	}
+
+	w := httptest.NewRecorder()
+	c.RenderApp(w, withUser(httptest.NewRequest(http.MethodGet, "/t", nil), &mockUser{id: 1, permissions: []string{"Applet.Blocked"}}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAppletController_RPCCodedError(t *testing.T) {
+	t.Parallel()
+
+	type quotaDetails struct {
+		Limit int `json:"limit"`
+	}
+	quota := api.ErrorCode[quotaDetails]{Code: "quota_exceeded", Message: "Quota exceeded."}
+	locked := api.ErrorCode[struct{}]{Code: "conversation_locked", Message: "Conversation is locked."}
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"chat.send": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return nil, fmt.Errorf("send: %w", quota.Wrap(errors.New("db: 10 of 10 used"), quotaDetails{Limit: 10}))
+				}},
+				"chat.edit": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					return nil, locked.New(struct{}{})
+				}},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	call := func(method string) string {
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(`{"id":"1","method":"`+method+`"}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	assert.JSONEq(t, `{"id":"1","error":{"code":"quota_exceeded","message":"Quota exceeded.","details":{"limit":10}}}`, call("chat.send"))
+	assert.JSONEq(t, `{"id":"1","error":{"code":"conversation_locked","message":"Conversation is locked."}}`, call("chat.edit"))
+}
+
+func TestAppletController_PanicRecovery(t *testing.T) {
+	t.Parallel()
+
+	boom := func(ctx context.Context, params json.RawMessage) (any, error) { panic("boom") }
+	panicky := api.Func("panicky", func(context.Context, api.AppletUser, json.RawMessage) (bool, error) { panic("predicate") })
+	rpcCfg := &api.RPCConfig{
+		Path:             "/rpc",
+		BatchConcurrency: 2,
+		Methods: map[string]api.RPCMethod{
+			"boom":    {Handler: boom},
+			"ok":      {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+			"guarded": {Permissions: panicky, Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "ok", nil }},
+			"stream": {Stream: func(ctx context.Context, params json.RawMessage, emit func(event any) error) error {
+				if err := emit(1); err != nil {
+					return err
+				}
+				panic("stream")
+			}},
+		},
+	}
+	withUser := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), testUserKey, api.AppletUser(&mockUser{id: 1})))
+	}
+	post := func(c *Controller, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.handleRPC(w, withUser(httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body))))
+		return w
+	}
+
+	t.Run("Handler", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := &recordingMetrics{}
+		c := newTestController(t, withTestPermissions(panicky), withTestRPC(rpcCfg), withTestMetrics(metrics))
+		w := post(c, `{"id":"1","method":"boom"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id":"1","error":{"code":"internal","message":"internal error"}}`, w.Body.String())
+
+		var panics []recordedMetric
+		for _, m := range metrics.counters {
+			if m.name == panicMetric {
+				panics = append(panics, m)
+			}
+		}
+		require.Len(t, panics, 1)
+		assert.Equal(t, map[string]string{"applet": "t", "source": "rpc", "method": "boom"}, panics[0].labels)
+	})
+
+	t.Run("PermissionPredicate", func(t *testing.T) {
+		t.Parallel()
+
+		w := post(newTestController(t, withTestPermissions(panicky), withTestRPC(rpcCfg)), `{"id":"1","method":"guarded"}`)
+		assert.JSONEq(t, `{"id":"1","error":{"code":"internal","message":"internal error"}}`, w.Body.String())
+	})
+
+	t.Run("ConcurrentBatch", func(t *testing.T) {
+		t.Parallel()
+
+		w := post(newTestController(t, withTestPermissions(panicky), withTestRPC(rpcCfg)), `[{"id":"1","method":"boom"},{"id":"2","method":"guarded"},{"id":"3","method":"ok"}]`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resps []rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resps))
+		require.Len(t, resps, 3)
+		assert.Equal(t, "internal", resps[0].Error.Code)
+		assert.Equal(t, "internal", resps[1].Error.Code)
+		assert.Nil(t, resps[2].Error)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		t.Parallel()
+
+		w := post(newTestController(t, withTestPermissions(panicky), withTestRPC(rpcCfg)), `{"id":"1","method":"stream"}`)
+		assert.Equal(t, "event: result\ndata: 1\n\nevent: error\ndata: {\"code\":\"internal\",\"message\":\"internal error\"}\n\n", w.Body.String())
+	})
+
+	t.Run("RenderApp", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		c := newTestController(t, withTestPermissions(panicky), withTestRPC(rpcCfg))
+		c.RenderApp(w, withUser(httptest.NewRequest(http.MethodGet, "/t", nil)))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestAppletController_RPCWebSocket(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(t *testing.T, withUser bool, wrap func(http.Handler) http.Handler, opts ...func(*api.RPCWebSocketConfig)) *httptest.Server {
+		t.Helper()
+		a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+			WindowGlobal: "__T__",
+			Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+			Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+			RPC: &api.RPCConfig{
+				Path: "/rpc",
+				WebSocket: &api.RPCWebSocketConfig{
+					AllowedOrigins: []string{"https://app.example.com"},
+					OnConnect: func(ctx context.Context, conn api.RPCConnection) {
+						_ = conn.Notify("welcome", map[string]string{"hello": "world"})
+					},
+				},
+				Methods: map[string]api.RPCMethod{
+					"echo": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+						if conn, ok := api.RPCConnectionFrom(ctx); ok {
+							if err := conn.Notify("echoed", nil); err != nil {
+								return nil, err
+							}
+						}
+						return params, nil
+					}},
+					"count": {Stream: func(ctx context.Context, params json.RawMessage, emit func(event any) error) error {
+						for i := 1; i <= 2; i++ {
+							if err := emit(map[string]int{"n": i}); err != nil {
+								return err
+							}
+						}
+						return nil
+					}},
+					"secret": {
+						RequirePermissions: []string{"test.secret"},
+						Handler:            func(ctx context.Context, params json.RawMessage) (any, error) { return "secret", nil },
+					},
+				},
+			},
+		}}
+		for _, opt := range opts {
+			opt(a.config.RPC.WebSocket)
+		}
+		c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+		require.NoError(t, err)
+		var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if withUser {
+				mockU := &mockUser{id: 1, email: "t@example.com", firstName: "T", lastName: "U"}
+				r = r.WithContext(context.WithValue(r.Context(), testUserKey, api.AppletUser(mockU)))
+			}
+			if r.URL.Path == "/token" {
+				_, _ = io.WriteString(w, csrf.Token(r))
+				return
+			}
+			c.handleRPC(w, r)
+		})
+		if wrap != nil {
+			h = wrap(h)
+		}
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	wsURL := func(srv *httptest.Server) string {
+		return "ws" + strings.TrimPrefix(srv.URL, "http") + "/t/rpc"
+	}
+	readJSON := func(t *testing.T, conn *websocket.Conn) map[string]any {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		op, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.TextMessage, op)
+		var msg map[string]any
+		require.NoError(t, json.Unmarshal(data, &msg))
+		return msg
+	}
+	dial := func(t *testing.T, srv *httptest.Server) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		assert.Equal(t, map[string]any{"method": "welcome", "params": map[string]any{"hello": "world"}}, readJSON(t, conn))
+		return conn
+	}
+
+	t.Run("CallsAndNotifications", func(t *testing.T) {
+		t.Parallel()
+
+		conn := dial(t, newServer(t, true, nil))
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","method":"echo","params":{"a":1}}`)))
+		assert.Equal(t, map[string]any{"method": "echoed"}, readJSON(t, conn))
+		assert.Equal(t, map[string]any{"id": "1", "result": map[string]any{"a": float64(1)}}, readJSON(t, conn))
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"2","method":"secret","params":{}}`)))
+		msg := readJSON(t, conn)
+		assert.Equal(t, "2", msg["id"])
+		assert.Equal(t, "forbidden", msg["error"].(map[string]any)["code"])
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`not json`)))
+		assert.Equal(t, "invalid_request", readJSON(t, conn)["error"].(map[string]any)["code"])
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		t.Parallel()
+
+		conn := dial(t, newServer(t, true, nil))
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"s","method":"count","params":{}}`)))
+		assert.Equal(t, map[string]any{"id": "s", "event": map[string]any{"n": float64(1)}}, readJSON(t, conn))
+		assert.Equal(t, map[string]any{"id": "s", "event": map[string]any{"n": float64(2)}}, readJSON(t, conn))
+		assert.Equal(t, map[string]any{"id": "s", "done": true}, readJSON(t, conn))
+	})
+
+	t.Run("RejectsForeignOrigin", func(t *testing.T) {
+		t.Parallel()
+
+		srv := newServer(t, true, nil)
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL(srv), http.Header{"Origin": {"https://evil.example.com"}})
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv), http.Header{"Origin": {"https://app.example.com"}})
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+
+	t.Run("RequiresUser", func(t *testing.T) {
+		t.Parallel()
+
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL(newServer(t, false, nil)), nil)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("TicketWithCSRF", func(t *testing.T) {
+		t.Parallel()
+
+		protect := csrf.Protect([]byte("0123456789abcdef0123456789abcdef"), csrf.Secure(false))
+		srv := newServer(t, true, func(h http.Handler) http.Handler {
+			h = protect(h)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h.ServeHTTP(w, csrf.PlaintextHTTPRequest(r))
+			})
+		})
+		resp, err := http.Get(srv.URL + "/token")
+		require.NoError(t, err)
+		token, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		cookie := http.Header{"Cookie": {resp.Header.Get("Set-Cookie")}}
+		issueTicket := func(t *testing.T, csrfToken string) *http.Response {
+			t.Helper()
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/t/rpc", strings.NewReader(`{"id":"1","method":"__wsTicket"}`))
+			require.NoError(t, err)
+			req.Header = cookie.Clone()
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-CSRF-Token", csrfToken)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = resp.Body.Close() })
+			return resp
+		}
+
+		_, resp, err = websocket.DefaultDialer.Dial(wsURL(srv), cookie)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		// Tickets are only issued to requests passing the CSRF check.
+		assert.Equal(t, http.StatusForbidden, issueTicket(t, "forged").StatusCode)
+
+		resp = issueTicket(t, string(token))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var ticketResp struct {
+			Result struct {
+				Ticket string `json:"ticket"`
+			} `json:"result"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&ticketResp))
+		require.NotEmpty(t, ticketResp.Result.Ticket)
+		ticketURL := wsURL(srv) + "?ticket=" + url.QueryEscape(ticketResp.Result.Ticket)
+
+		conn, _, err := websocket.DefaultDialer.Dial(ticketURL, cookie)
+		require.NoError(t, err)
+		_ = conn.Close()
+
+		// Tickets are single-use.
+		_, resp, err = websocket.DefaultDialer.Dial(ticketURL, cookie)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("DropsUnresponsiveClient", func(t *testing.T) {
+		t.Parallel()
+
+		srv := newServer(t, true, nil, func(wsCfg *api.RPCWebSocketConfig) { wsCfg.PingInterval = 20 * time.Millisecond })
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		// The client swallows pings instead of answering them.
+		conn.SetPingHandler(func(string) error { return nil })
+		assert.Equal(t, "welcome", readJSON(t, conn)["method"])
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr)
+		assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+	})
+}
+
+func TestAppletController_RPCDescribe(t *testing.T) {
+	t.Parallel()
+
+	desc := &api.TypedRouterDescription{Methods: []api.TypedMethodDescription{{Name: "t.ping", Deprecated: true}}}
+	newController := func(t *testing.T, dev bool, introspection *api.RPCIntrospectionConfig) *Controller {
+		t.Helper()
+		assets := api.AssetConfig{
+			FS:           fstest.MapFS{"manifest.json": {Data: []byte(`{"index.html":{"file":"a.js","isEntry":true}}`)}, "a.js": {Data: []byte("console.log('ok')")}},
+			ManifestPath: "manifest.json",
+			Entrypoint:   "index.html",
+		}
+		if dev {
+			assets = api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}}
+		}
+		a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+			WindowGlobal: "__T__",
+			Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+			Assets:       assets,
+			RPC: &api.RPCConfig{
+				Path:          "/rpc",
+				Introspection: introspection,
+				Describe:      func() (*api.TypedRouterDescription, error) { return desc, nil },
+				Methods: map[string]api.RPCMethod{
+					"t.ping": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return nil, nil }},
+				},
+			},
+		}}
+		c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+		require.NoError(t, err)
+		return c
+	}
+	// The description is served by the RPC endpoint itself, at the path the
+	// host mounts it on.
+	get := func(c *Controller, perms ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/rpc?method=__describe", nil)
+		if perms != nil {
+			mockU := &mockUser{id: 1, email: "t@example.com", firstName: "T", lastName: "U", permissions: perms}
+			req = req.WithContext(context.WithValue(req.Context(), testUserKey, api.AppletUser(mockU)))
+		}
+		w := httptest.NewRecorder()
+		c.ServeRPC(w, req)
+		return w
+	}
+
+	t.Run("DevFlag", func(t *testing.T) {
+		t.Parallel()
+
+		w := get(newController(t, true, &api.RPCIntrospectionConfig{Dev: true}))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var got api.TypedRouterDescription
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, *desc, got)
+
+		assert.Equal(t, http.StatusForbidden, get(newController(t, false, &api.RPCIntrospectionConfig{Dev: true})).Code)
+	})
+
+	t.Run("Permission", func(t *testing.T) {
+		t.Parallel()
+
+		r := newController(t, false, &api.RPCIntrospectionConfig{Permissions: api.Perm("rpc.describe")})
+		assert.Equal(t, http.StatusOK, get(r, "rpc.describe").Code)
+		assert.Equal(t, http.StatusForbidden, get(r, "other").Code)
+		assert.Equal(t, http.StatusForbidden, get(r).Code)
+	})
+
+	t.Run("NoPerAppletRoute", func(t *testing.T) {
+		t.Parallel()
+
+		r := mux.NewRouter()
+		newController(t, true, &api.RPCIntrospectionConfig{Dev: true}).RegisterRoutes(r)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/rpc/__describe", nil))
+		assert.NotEqual(t, "application/json", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		t.Parallel()
+
+		w := get(newController(t, true, nil))
+		assert.NotEqual(t, "application/json", w.Header().Get("Content-Type"))
+	})
+}
+
+func TestAppletController_RPCPlayground(t *testing.T) {
+	t.Parallel()
+
+	desc := &api.TypedRouterDescription{
+		Methods: []api.TypedMethodDescription{{Name: "t.ping", Params: api.TypeRef{Kind: "named", Name: "Ping"}, Result: api.TypeRef{Kind: "string"}}},
+		Types:   map[string]api.TypedTypeObject{"Ping": {Fields: []api.TypedField{{Name: "msg", Type: api.TypeRef{Kind: "string"}}}}},
+	}
+	newRouter := func(t *testing.T, dev bool) *mux.Router {
+		t.Helper()
+		assets := api.AssetConfig{
+			FS:           fstest.MapFS{"manifest.json": {Data: []byte(`{"index.html":{"file":"a.js","isEntry":true}}`)}, "a.js": {Data: []byte("console.log('ok')")}},
+			ManifestPath: "manifest.json",
+			Entrypoint:   "index.html",
+		}
+		if dev {
+			assets = api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}}
+		}
+		a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+			WindowGlobal: "__T__",
+			Shell:        api.ShellConfig{Mode: api.ShellModeStandalone, Title: "Test </script>"},
+			Assets:       assets,
+			RPC: &api.RPCConfig{
+				Path:     "/rpc",
+				Describe: func() (*api.TypedRouterDescription, error) { return desc, nil },
+				Methods: map[string]api.RPCMethod{
+					"t.ping": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "pong", nil }},
+				},
+			},
+		}}
+		c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+		require.NoError(t, err)
+		r := mux.NewRouter()
+		c.RegisterRoutes(r)
+		return r
+	}
+
+	t.Run("ServedInDevMode", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		newRouter(t, true).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/__playground", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		assert.Contains(t, body, "<title>Test &lt;/script&gt; · RPC playground</title>")
+		assert.Contains(t, body, `var endpoint = "/rpc";`)
+
+		const open = `<script type="application/json" id="rpc-description">`
+		start := strings.Index(body, open)
+		require.GreaterOrEqual(t, start, 0)
+		raw := body[start+len(open):]
+		raw = raw[:strings.Index(raw, "</script>")]
+		var got api.TypedRouterDescription
+		require.NoError(t, json.Unmarshal([]byte(raw), &got))
+		assert.Equal(t, *desc, got)
+	})
+
+	t.Run("NotServedOutsideDevMode", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		newRouter(t, false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/__playground", nil))
+		assert.NotContains(t, w.Body.String(), "RPC playground")
+	})
+}
+
+type memoryRecorder struct {
+	mu      sync.Mutex
+	records []api.RPCRecord
+}
+
+func (r *memoryRecorder) Record(_ context.Context, rec api.RPCRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+	return nil
+}
+
+type memoryReplayer struct {
+	records []api.RPCRecord
+}
+
+func (r *memoryReplayer) Replay(_ context.Context, method, paramsHash string) (api.RPCRecord, bool) {
+	for _, rec := range r.records {
+		if rec.Method == method && rec.ParamsHash == paramsHash {
+			return rec, true
+		}
+	}
+	return api.RPCRecord{}, false
+}
+
+func TestAppletController_RPCRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	rpcConfig := func(recorder api.RPCRecorder, replayer api.RPCReplayer) *api.RPCConfig {
+		return &api.RPCConfig{
+			Path:     "/rpc",
+			Recorder: recorder,
+			Replayer: replayer,
+			Methods: map[string]api.RPCMethod{
+				"login": {
+					Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+						calls++
+						var p struct {
+							User string `json:"user"`
+						}
+						if err := json.Unmarshal(params, &p); err != nil || p.User == "" {
+							return nil, fmt.Errorf("user is required: %w", api.ErrValidation)
+						}
+						return map[string]string{"user": p.User, "token": "t-" + p.User}, nil
+					},
+					RedactParams: func(params json.RawMessage) any { return map[string]string{"password": "[REDACTED]"} },
+					RedactResult: func(result any) any {
+						m := result.(map[string]string)
+						return map[string]string{"user": m["user"], "token": "[REDACTED]"}
+					},
+				},
+			},
+		}
+	}
+	call := func(c *Controller, body string) rpcResponse {
+		w := httptest.NewRecorder()
+		c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/t/rpc", bytes.NewBufferString(body)))
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	recorder := &memoryRecorder{}
+	c := newTestController(t, withTestRPC(rpcConfig(recorder, nil)))
+	call(c, `{"id":"1","method":"login","params":{"user":"ann","password":"pw"}}`)
+	call(c, `{"id":"2","method":"login","params":{}}`)
+	call(c, `{"id":"3","method":"missing","params":{}}`)
+	require.Equal(t, 2, calls)
+	require.Len(t, recorder.records, 2, "unknown methods are not recorded")
+
+	ok := recorder.records[0]
+	assert.Equal(t, "login", ok.Method)
+	assert.Equal(t, recording.HashParams(json.RawMessage(`{"user":"ann","password":"pw"}`)), ok.ParamsHash)
+	assert.JSONEq(t, `{"password":"[REDACTED]"}`, string(ok.Params))
+	assert.JSONEq(t, `{"user":"ann","token":"[REDACTED]"}`, string(ok.Result))
+	assert.Nil(t, ok.Error)
+	failed := recorder.records[1]
+	require.NotNil(t, failed.Error)
+	assert.Equal(t, "validation", failed.Error.Code)
+	assert.Nil(t, failed.Result)
+
+	c = newTestController(t, withTestRPC(rpcConfig(recorder, &memoryReplayer{records: recorder.records})))
+	resp := call(c, `{"id":"9","method":"login","params":{"password":"pw","user":"ann"}}`)
+	assert.Equal(t, "9", resp.ID)
+	assert.Equal(t, map[string]any{"user": "ann", "token": "[REDACTED]"}, resp.Result)
+	resp = call(c, `{"id":"10","method":"login","params":{}}`)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "validation", resp.Error.Code)
+	resp = call(c, `{"id":"11","method":"login","params":{"user":"bob"}}`)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "not_found", resp.Error.Code)
+	assert.Equal(t, 2, calls, "replayed calls don't run handlers")
+	assert.Len(t, recorder.records, 2, "replayed calls are not recorded")
+
+	prod := api.AssetConfig{
+		FS:           fstest.MapFS{"manifest.json": {Data: []byte(`{"index.html":{"file":"a.js","isEntry":true}}`)}, "a.js": {Data: []byte("console.log('ok')")}},
+		ManifestPath: "manifest.json",
+		Entrypoint:   "index.html",
+	}
+	c = newTestController(t, withTestAssets(prod), withTestRPC(rpcConfig(nil, &memoryReplayer{records: recorder.records})))
+	resp = call(c, `{"id":"12","method":"login","params":{"user":"bob"}}`)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, map[string]any{"user": "bob", "token": "t-bob"}, resp.Result)
+	assert.Equal(t, 3, calls, "the replayer is ignored without the dev proxy")
+}
+
+func TestAppletController_RPCUpload(t *testing.T) {
+	t.Parallel()
+
+	type received struct {
+		Field, Filename, ContentType, Body string
+	}
+	lateRead := make(chan error, 1)
+	upload := api.RPCMethod{
+		Upload:       true,
+		MaxBodyBytes: 1024,
+		MaxFileBytes: 16,
+		AllowedTypes: []string{"text/csv", "image/*"},
+		Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+			files, ok := api.UploadFilesFrom(ctx)
+			if !ok {
+				return nil, fmt.Errorf("no files: %w", api.ErrInvalid)
+			}
+			out := []received{}
+			for {
+				f, err := files.Next()
+				if errors.Is(err, io.EOF) {
+					return map[string]any{"params": params, "files": out}, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				data, err := io.ReadAll(f.Body)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, received{f.Field, f.Filename, f.ContentType, string(data)})
+			}
+		},
+	}
+	a := &testApplet{name: "t", basePath: "/t", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"sheet.import": upload,
+				"slow.import": {Upload: true, Timeout: 10 * time.Millisecond, Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+					<-ctx.Done()
+					time.Sleep(20 * time.Millisecond) // keeps running past the timeout
+					files, _ := api.UploadFilesFrom(ctx)
+					_, err := files.Next()
+					lateRead <- err
+					return nil, nil
+				}},
+				"ping": {Handler: func(ctx context.Context, params json.RawMessage) (any, error) { return "pong", nil }},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, &testHostServices{})
+	require.NoError(t, err)
+
+	type part struct{ field, filename, contentType, body string }
+	callEncoded := func(t *testing.T, encoding string, parts ...part) (int, rpcResponse) {
+		t.Helper()
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, p := range parts {
+			h := textproto.MIMEHeader{}
+			disposition := fmt.Sprintf(`form-data; name=%q`, p.field)
+			if p.filename != "" {
+				disposition += fmt.Sprintf(`; filename=%q`, p.filename)
+			}
+			h.Set("Content-Disposition", disposition)
+			if p.contentType != "" {
+				h.Set("Content-Type", p.contentType)
+			}
+			pw, err := mw.CreatePart(h)
+			require.NoError(t, err)
+			_, _ = pw.Write([]byte(p.body))
+		}
+		require.NoError(t, mw.Close())
+		var body io.Reader = &buf
+		if encoding == "gzip" {
+			var zbuf bytes.Buffer
+			zw := gzip.NewWriter(&zbuf)
+			_, _ = zw.Write(buf.Bytes())
+			require.NoError(t, zw.Close())
+			body = &zbuf
+		}
+		r := httptest.NewRequest(http.MethodPost, "/t/rpc", body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		if encoding != "" {
+			r.Header.Set("Content-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		c.handleRPC(w, r)
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+	call := func(t *testing.T, parts ...part) (int, rpcResponse) {
+		t.Helper()
+		return callEncoded(t, "", parts...)
+	}
+	request := func(method string) part {
+		return part{field: "request", body: fmt.Sprintf(`{"id":"1","method":%q,"params":{"sheet":"Q1"}}`, method)}
+	}
+
+	t.Run("StreamsFiles", func(t *testing.T) {
+		t.Parallel()
+		code, resp := call(t, request("sheet.import"),
+			part{"file", "a.csv", "text/csv; charset=utf-8", "a,b\n1,2"},
+			part{"file", "logo.png", "image/png", "png"},
+		)
+		require.Equal(t, http.StatusOK, code)
+		require.Nil(t, resp.Error)
+		assert.Equal(t, map[string]any{
+			"params": map[string]any{"sheet": "Q1"},
+			"files": []any{
+				map[string]any{"Field": "file", "Filename": "a.csv", "ContentType": "text/csv", "Body": "a,b\n1,2"},
+				map[string]any{"Field": "file", "Filename": "logo.png", "ContentType": "image/png", "Body": "png"},
+			},
+		}, resp.Result)
+	})
+
+	t.Run("FileTooLarge", func(t *testing.T) {
+		t.Parallel()
+		_, resp := call(t, request("sheet.import"), part{"file", "big.csv", "text/csv", strings.Repeat("x", 17)})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "payload_too_large", resp.Error.Code)
+	})
+
+	t.Run("BodyTooLarge", func(t *testing.T) {
+		t.Parallel()
+		parts := []part{request("sheet.import")}
+		for i := 0; i < 100; i++ {
+			parts = append(parts, part{"file", fmt.Sprintf("%d.csv", i), "text/csv", "0123456789"})
+		}
+		_, resp := call(t, parts...)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "payload_too_large", resp.Error.Code)
+	})
+
+	t.Run("TypeNotAllowed", func(t *testing.T) {
+		t.Parallel()
+		_, resp := call(t, request("sheet.import"), part{"file", "a.exe", "application/octet-stream", "MZ"})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid", resp.Error.Code)
+	})
+
+	t.Run("MissingRequestPart", func(t *testing.T) {
+		t.Parallel()
+		code, resp := call(t, part{"file", "a.csv", "text/csv", "a"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid_request", resp.Error.Code)
+	})
+
+	t.Run("CompressedBody", func(t *testing.T) {
+		t.Parallel()
+		code, resp := callEncoded(t, "gzip", request("sheet.import"), part{"file", "a.csv", "text/csv", "a,b"})
+		require.Equal(t, http.StatusOK, code)
+		require.Nil(t, resp.Error)
+		assert.Len(t, resp.Result.(map[string]any)["files"], 1)
+
+		code, resp = callEncoded(t, "zstd", request("sheet.import"), part{"file", "a.csv", "text/csv", "a,b"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid_request", resp.Error.Code)
+	})
+
+	t.Run("TimeoutWaitsForHandler", func(t *testing.T) {
+		t.Parallel()
+		_, resp := call(t, request("slow.import"), part{"file", "a.csv", "text/csv", "a,b"})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "timeout", resp.Error.Code)
+		// The handler returned before the response was written and could not
+		// read the body after its call ended.
+		select {
+		case err := <-lateRead:
+			assert.ErrorIs(t, err, errUploadEnded)
+		default:
+			t.Fatal("response was written before the handler returned")
+		}
+	})
+
+	t.Run("NotAnUploadMethod", func(t *testing.T) {
+		t.Parallel()
+		code, resp := call(t, request("ping"))
+		assert.Equal(t, http.StatusBadRequest, code)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "invalid_request", resp.Error.Code)
+	})
+}
+
+type countingHost struct {
+	testHostServices
+	users atomic.Int32
+}
+
+func (h *countingHost) ExtractUser(ctx context.Context) (api.AppletUser, error) {
+	h.users.Add(1)
+	return h.testHostServices.ExtractUser(ctx)
+}
+
+func TestAppletController_RPCIdentity(t *testing.T) {
+	t.Parallel()
+
+	tenantID := uuid.New()
+	host := &countingHost{}
+	a := &testApplet{name: "chat", basePath: "/chat", config: api.Config{
+		WindowGlobal: "__T__",
+		Shell:        api.ShellConfig{Mode: api.ShellModeStandalone},
+		Assets:       api.AssetConfig{Dev: &api.DevAssetConfig{Enabled: true, TargetURL: "http://localhost:5173"}},
+		RPC: &api.RPCConfig{
+			Path: "/rpc",
+			Methods: map[string]api.RPCMethod{
+				"whoami": {
+					RequirePermissions: []string{"Chat.Read"},
+					Permissions:        api.AllOf(api.Perm("Chat.Read")),
+					Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+						u, ok := api.UserFrom(ctx)
+						if !ok {
+							return nil, fmt.Errorf("no user: %w", api.ErrInternal)
+						}
+						tid, _ := api.TenantIDFrom(ctx)
+						perms, _ := api.PermissionsFrom(ctx)
+						locale, _ := api.LocaleFrom(ctx)
+						applet, _ := api.AppletFrom(ctx)
+						return map[string]any{
+							"user": u.ID(), "tenant": tid.String(), "permissions": perms,
+							"locale": locale.String(), "applet": applet,
+						}, nil
+					},
+				},
+			},
+		},
+	}}
+	c, err := New(a, nil, api.DefaultSessionConfig, nil, nil, host)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), testUserKey, &mockUser{id: 7, permissions: []string{"Chat.Read"}})
+	ctx = context.WithValue(ctx, testTenantIDKey, tenantID)
+	ctx = context.WithValue(ctx, testLocaleKey, language.Russian)
+	req := httptest.NewRequest(http.MethodPost, "/chat/rpc", bytes.NewBufferString(`{"id":"1","method":"whoami","params":{}}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	c.handleRPC(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp rpcResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Nil(t, resp.Error)
+	assert.Equal(t, map[string]any{
+		"user": float64(7), "tenant": tenantID.String(), "permissions": []any{"Chat.Read"},
+		"locale": "ru", "applet": "chat",
+	}, resp.Result)
+	assert.Equal(t, int32(1), host.users.Load(), "the user is extracted once per request")
+
+	w = httptest.NewRecorder()
+	c.handleRPC(w, httptest.NewRequest(http.MethodPost, "/chat/rpc", bytes.NewBufferString(`{"id":"2","method":"whoami","params":{}}`)))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, "forbidden", resp.Error.Code)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const (
+	panicMetric = "applet.panics"
+
+	panicSourceRPC    = "rpc"
+	panicSourceRender = "render"
+)
+
+// panicError is a recovered panic. It wraps api.ErrInternal, so it is always
+// answered as "internal" without the panic value unless internal errors are
+// exposed.
+type panicError struct {
+	value any
+}
+
+func (e *panicError) Error() string { return fmt.Sprintf("panic: %v", e.value) }
+
+func (e *panicError) Unwrap() error { return api.ErrInternal }
+
+// recovered logs a recovered panic value with its stack trace, counts it in
+// the panic metric and returns it as an error. It must be called from the
+// deferred function that recovered, so the stack still shows the panic site.
+func (c *Controller) recovered(source, method string, v any) *panicError {
+	c.logger.
+		WithField("source", source).
+		WithField("method", method).
+		WithField("panic", fmt.Sprint(v)).
+		WithField("stack", string(debug.Stack())).
+		Error("Recovered panic")
+	if c.metrics != nil {
+		c.metrics.IncrementCounter(panicMetric, map[string]string{
+			"applet": c.applet.Name(),
+			"source": source,
+			"method": method,
+		})
+	}
+	return &panicError{value: v}
+}
+
+// panicRPCError is the error envelope for a recovered panic.
+func panicRPCError(err *panicError, exposeInternalErrors bool) *rpcError {
+	return &rpcError{Code: "internal", Message: mapRPCErrorMessage("internal", err, exposeInternalErrors)}
+}
+
+// recoverRPCRequest answers a panic that escaped the per-call recovery with
+// a 500 "internal" envelope. Use it as a deferred call.
+func (c *Controller) recoverRPCRequest(w http.ResponseWriter, exposeInternalErrors bool, enc rpcEncoding) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	err := c.recovered(panicSourceRPC, "", v)
+	enc.write(w, http.StatusInternalServerError, rpcResponse{ID: "", Error: panicRPCError(err, exposeInternalErrors)})
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/a-h/templ"
 	"github.com/iota-uz/applets/internal/api"
+	"github.com/iota-uz/applets/internal/tracing"
 )
 
 type contextKey string
@@ -24,9 +26,28 @@ var scriptTagCloseRe = regexp.MustCompile(`(?i)</(script)>`)
 
 // RenderApp is the HTTP handler for rendering the applet HTML.
 func (c *Controller) RenderApp(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.Start(tracing.WithApplet(r.Context(), c.applet.Name()), c.tracer, "applet.render", nil)
+	defer span.End()
+	defer func() {
+		if v := recover(); v != nil {
+			span.RecordError(c.recovered(panicSourceRender, "", v))
+			http.Error(w, "Failed to render applet", http.StatusInternalServerError)
+		}
+	}()
+	r = r.WithContext(ctx)
+	if err := c.checkPermission(ctx, c.applet.Config().Permissions, nil); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, api.ErrPermissionDenied) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		c.logger.WithError(err).Error("failed to check applet permissions")
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
 	initialContext, err := c.builder.Build(ctx, r, c.applet.BasePath())
 	if err != nil {
+		span.RecordError(err)
 		http.Error(w, "Failed to build context", http.StatusInternalServerError)
 		return
 	}
@@ -46,7 +67,12 @@ func (c *Controller) render(ctx context.Context, w http.ResponseWriter, r *http.
 		return
 	}
 	mountHTML := buildMountElement(config.Mount)
+	_, assetSpan := tracing.Start(ctx, c.tracer, "applet.assets.resolve", nil)
 	cssLinks, jsScripts, err := c.buildAssetTags()
+	if err != nil {
+		assetSpan.RecordError(err)
+	}
+	assetSpan.End()
 	if err != nil {
 		c.logger.WithError(err).Error("failed to build asset tags")
 		http.Error(w, "Failed to resolve applet assets", http.StatusInternalServerError)
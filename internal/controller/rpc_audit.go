@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// withRequestID stores the request's X-Request-ID, or a new ID when the
+// header is missing, in the request context and echoes it on the response.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := strings.TrimSpace(r.Header.Get(requestIDHeader))
+	if id == "" || len(id) > 128 {
+		id = uuid.NewString()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// auditRPC sends an audited call to the audit sink. Sink failures are logged
+// and do not affect the response.
+func (c *Controller) auditRPC(ctx context.Context, method string, rpcMethod api.RPCMethod, req rpcRequest, rpcErr *rpcError, start time.Time) {
+	if c.auditSink == nil || !rpcMethod.Audit {
+		return
+	}
+	userID, tenantID := c.callerIdentity(ctx)
+	event := api.AuditEvent{
+		RequestID: requestIDFrom(ctx),
+		UserID:    userID,
+		TenantID:  tenantID,
+		Method:    method,
+		Code:      "ok",
+		Duration:  time.Since(start),
+		Time:      start,
+	}
+	if rpcErr != nil {
+		event.Code = rpcErr.Code
+	}
+	if rpcMethod.AuditParams != nil {
+		event.Params = rpcMethod.AuditParams(req.Params)
+	}
+	if err := c.auditSink.Record(ctx, event); err != nil {
+		c.logger.WithField("method", method).WithError(err).Error("Failed to record RPC audit event")
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// rpcDescribeMethod is the built-in query method that serves the RPC
+// description: GET <RPCConfig.Path>?method=__describe.
+const rpcDescribeMethod = "__describe"
+
+// handleRPCDescribe serves the RPC router description to users allowed by
+// RPCConfig.Introspection.
+func (c *Controller) handleRPCDescribe(w http.ResponseWriter, r *http.Request) {
+	rpcCfg := c.applet.Config().RPC
+	if rpcCfg == nil || rpcCfg.Introspection == nil || rpcCfg.Describe == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := c.authorizeRPCDescribe(r.Context(), rpcCfg.Introspection); err != nil {
+		if errors.Is(err, api.ErrPermissionDenied) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		c.logger.WithError(err).Error("failed to check RPC introspection permissions")
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
+	desc, err := rpcCfg.Describe()
+	if err != nil {
+		c.logger.WithError(err).Error("failed to describe RPC router")
+		http.Error(w, "Failed to describe RPC router", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(desc); err != nil {
+		c.logger.WithError(err).Error("failed to write RPC description")
+	}
+}
+
+func (c *Controller) authorizeRPCDescribe(ctx context.Context, cfg *api.RPCIntrospectionConfig) error {
+	if cfg.Dev && c.devAssets != nil {
+		return nil
+	}
+	if cfg.Permissions == nil {
+		return api.ErrPermissionDenied
+	}
+	return c.checkPermission(ctx, cfg.Permissions, nil)
+}
@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const (
+	defaultRPCCompressionThreshold = 8 << 10
+	jsonContentType                = "application/json"
+	// rpcVary lists the request headers every encoded response depends on.
+	rpcVary = "Accept, Accept-Encoding"
+)
+
+var (
+	errRPCBodyTooLarge         = errors.New("request too large")
+	errRPCUnsupportedEncoding  = errors.New("unsupported content encoding")
+	errRPCUnsupportedMediaType = errors.New("unsupported content type")
+	errRPCInvalidPayload       = errors.New("invalid request payload")
+)
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Encoding() string { return "gzip" }
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+// rpcEncoding is the response encoding negotiated for one RPC request. A nil
+// codec means JSON and a nil compressor means no compression.
+type rpcEncoding struct {
+	codec      api.RPCCodec
+	compressor api.RPCCompressor
+	threshold  int
+}
+
+// negotiateRPCEncoding picks the response codec from Accept (falling back to
+// the request's codec, then JSON) and the compressor from Accept-Encoding.
+func negotiateRPCEncoding(r *http.Request, rpcCfg *api.RPCConfig) rpcEncoding {
+	enc := rpcEncoding{threshold: rpcCfg.CompressionThreshold}
+	if enc.threshold == 0 {
+		enc.threshold = defaultRPCCompressionThreshold
+	}
+
+	if accept := r.Header.Get("Accept"); accept != "" {
+		offers := make([]string, 0, len(rpcCfg.Codecs)+1)
+		offers = append(offers, jsonContentType)
+		for _, codec := range rpcCfg.Codecs {
+			offers = append(offers, codec.ContentType())
+		}
+		if best := negotiate(accept, offers, matchMediaRange); best > 0 {
+			enc.codec = rpcCfg.Codecs[best-1]
+		}
+	} else if codec, err := requestCodec(r, rpcCfg); err == nil {
+		enc.codec = codec
+	}
+
+	if enc.threshold > 0 {
+		if acceptEncoding := r.Header.Get("Accept-Encoding"); acceptEncoding != "" {
+			compressors := rpcCompressors(rpcCfg)
+			offers := make([]string, len(compressors))
+			for i, comp := range compressors {
+				offers[i] = comp.Encoding()
+			}
+			if best := negotiate(acceptEncoding, offers, matchEncoding); best >= 0 {
+				enc.compressor = compressors[best]
+			}
+		}
+	}
+	return enc
+}
+
+// write encodes resp and writes it with status, compressing bodies at or above
+// the threshold. It returns the number of body bytes written.
+func (e rpcEncoding) write(w http.ResponseWriter, status int, resp any) int {
+	body, contentType, err := e.encode(resp)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return 0
+	}
+	h := w.Header()
+	h.Add("Vary", rpcVary)
+	if e.compressor != nil && len(body) >= e.threshold {
+		compressed, err := compress(e.compressor, body)
+		if err == nil {
+			body = compressed
+			h.Set("Content-Encoding", e.compressor.Encoding())
+		}
+	}
+	h.Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	n, _ := w.Write(body)
+	return n
+}
+
+func (e rpcEncoding) encode(resp any) ([]byte, string, error) {
+	data, err := encodeRPCJSON(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	if e.codec == nil {
+		return append(data, '\n'), "application/json; charset=utf-8", nil
+	}
+	generic, err := jsonToGeneric(data)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := e.codec.Marshal(generic)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, e.codec.ContentType(), nil
+}
+
+// encodeRPCJSON encodes v as JSON without HTML escaping or a trailing newline.
+func encodeRPCJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// readRPCBody reads the request body, decompressing it per Content-Encoding
+// and converting it to JSON per Content-Type. maxBytes limits both the body
+// as sent and the decompressed body.
+func readRPCBody(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, maxBytes int64) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	codec, err := requestCodec(r, rpcCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = r.Body
+	if encoding := strings.TrimSpace(r.Header.Get("Content-Encoding")); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		comp := findCompressor(rpcCfg, encoding)
+		if comp == nil {
+			return nil, errRPCUnsupportedEncoding
+		}
+		zr, err := comp.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errRPCInvalidPayload, err)
+		}
+		defer func() { _ = zr.Close() }()
+		src = io.LimitReader(zr, maxBytes+1)
+	}
+	body, err := io.ReadAll(src)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, errRPCBodyTooLarge
+		}
+		return nil, fmt.Errorf("%w: %w", errRPCInvalidPayload, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, errRPCBodyTooLarge
+	}
+	if codec == nil {
+		return body, nil
+	}
+
+	var generic any
+	if err := codec.Unmarshal(body, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %w", errRPCInvalidPayload, err)
+	}
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errRPCInvalidPayload, err)
+	}
+	return data, nil
+}
+
+// requestCodec returns the codec for the request's Content-Type, or nil for JSON.
+func requestCodec(r *http.Request, rpcCfg *api.RPCConfig) (api.RPCCodec, error) {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return nil, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, errRPCUnsupportedMediaType
+	}
+	if mediaType == jsonContentType || mediaType == "text/plain" {
+		return nil, nil
+	}
+	for _, codec := range rpcCfg.Codecs {
+		if strings.EqualFold(codec.ContentType(), mediaType) {
+			return codec, nil
+		}
+	}
+	return nil, errRPCUnsupportedMediaType
+}
+
+// rpcCompressors returns the configured compressors followed by gzip.
+func rpcCompressors(rpcCfg *api.RPCConfig) []api.RPCCompressor {
+	out := make([]api.RPCCompressor, 0, len(rpcCfg.Compressors)+1)
+	out = append(out, rpcCfg.Compressors...)
+	return append(out, gzipCompressor{})
+}
+
+func findCompressor(rpcCfg *api.RPCConfig, encoding string) api.RPCCompressor {
+	for _, comp := range rpcCompressors(rpcCfg) {
+		if strings.EqualFold(comp.Encoding(), encoding) {
+			return comp
+		}
+	}
+	return nil
+}
+
+func compress(comp api.RPCCompressor, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := comp.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiate returns the index of the offer with the highest q-value in header,
+// preferring earlier offers on ties, or -1 when none is acceptable.
+func negotiate(header string, offers []string, match func(pattern, offer string) bool) int {
+	best, bestQ := -1, 0.0
+	for i, offer := range offers {
+		q := 0.0
+		for _, part := range strings.Split(header, ",") {
+			pattern, pq := parseQ(part)
+			if pattern != "" && match(pattern, offer) && pq > q {
+				q = pq
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+func parseQ(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	value := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return value, q
+}
+
+func matchMediaRange(pattern, offer string) bool {
+	offer = strings.ToLower(offer)
+	if pattern == "*/*" || pattern == offer {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(offer, prefix+"/")
+}
+
+func matchEncoding(pattern, offer string) bool {
+	return pattern == "*" || pattern == strings.ToLower(offer)
+}
+
+// jsonToGeneric decodes JSON into generic values for a non-JSON codec.
+// Integral numbers become int64 so codecs keep them exact.
+func jsonToGeneric(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return convertJSONNumbers(v), nil
+}
+
+func convertJSONNumbers(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]any:
+		for k, item := range t {
+			t[k] = convertJSONNumbers(item)
+		}
+	case []any:
+		for i, item := range t {
+			t[i] = convertJSONNumbers(item)
+		}
+	}
+	return v
+}
@@ -7,16 +7,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/iota-uz/applets/internal/api"
+	appletctx "github.com/iota-uz/applets/internal/context"
+	"github.com/iota-uz/applets/internal/recording"
+	"github.com/iota-uz/applets/internal/stream"
+	"github.com/iota-uz/applets/internal/tracing"
 )
 
 type rpcRequest struct {
-	ID     string          `json:"id"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params"`
+	ID             string          `json:"id"`
+	Method         string          `json:"method"`
+	Params         json.RawMessage `json:"params"`
+	IdempotencyKey string          `json:"idempotencyKey,omitempty"`
 }
 
 type rpcResponse struct {
@@ -31,6 +42,31 @@ type rpcError struct {
 	Details any    `json:"details,omitempty"`
 }
 
+func (e *rpcError) Error() string { return e.Code + ": " + e.Message }
+
+const (
+	defaultRPCMaxBodyBytes   = 1 << 20
+	defaultRPCMaxBatchSize   = 32
+	defaultRPCIdempotencyTTL = 24 * time.Hour
+)
+
+// rpcResult is the outcome of dispatching a single call. status is only used
+// when the call is the whole request; batched calls always answer 200.
+type rpcResult struct {
+	status int
+	resp   rpcResponse
+	header http.Header
+	// handlerDone, when set, is closed once the handler of a call that was
+	// answered without waiting for it has returned.
+	handlerDone <-chan struct{}
+}
+
+// ServeRPC serves the applet's RPC endpoint. The controller does not route
+// it; hosts and the applettest harness call it directly.
+func (c *Controller) ServeRPC(w http.ResponseWriter, r *http.Request) {
+	c.handleRPC(w, r)
+}
+
 func (c *Controller) handleRPC(w http.ResponseWriter, r *http.Request) {
 	config := c.applet.Config()
 	rpcCfg := config.RPC
@@ -38,81 +74,657 @@ func (c *Controller) handleRPC(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	r = withRequestID(w, r.WithContext(c.withIdentity(tracing.WithApplet(r.Context(), c.applet.Name()))))
 	exposeInternalErrors := false
 	if rpcCfg.ExposeInternalErrors != nil {
 		exposeInternalErrors = *rpcCfg.ExposeInternalErrors
 	}
-	maxBytes := rpcCfg.MaxBodyBytes
-	if maxBytes <= 0 {
-		maxBytes = 1 << 20
+	enc := negotiateRPCEncoding(r, rpcCfg)
+	defer c.recoverRPCRequest(w, exposeInternalErrors, enc)
+	if rpcCfg.WebSocket != nil && websocket.IsWebSocketUpgrade(r) {
+		c.handleRPCWebSocket(w, r, rpcCfg, exposeInternalErrors)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Query().Get("method") == rpcDescribeMethod {
+		c.handleRPCDescribe(w, r)
+		return
+	}
+	if r.Method == http.MethodGet {
+		c.handleRPCQuery(w, r, rpcCfg, exposeInternalErrors, enc)
+		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 	defer func() { _ = r.Body.Close() }()
+	if isMultipartRequest(r) {
+		c.handleRPCUpload(w, r, rpcCfg, exposeInternalErrors, enc)
+		return
+	}
 
-	var req rpcRequest
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&req); err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			writeRPC(w, http.StatusRequestEntityTooLarge, rpcResponse{ID: "", Error: &rpcError{Code: "payload_too_large", Message: "request too large"}})
+	body, err := readRPCBody(w, r, rpcCfg, rpcReadLimit(rpcCfg))
+	if err != nil {
+		switch {
+		case errors.Is(err, errRPCBodyTooLarge):
+			writeRPCTooLarge(w, enc, "")
+		case errors.Is(err, errRPCUnsupportedEncoding), errors.Is(err, errRPCUnsupportedMediaType):
+			enc.write(w, http.StatusUnsupportedMediaType, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: err.Error()}})
+		default:
+			enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+		}
+		return
+	}
+	if isBatchRequest(body) {
+		if int64(len(body)) > rpcMaxBodyBytes(rpcCfg) {
+			writeRPCTooLarge(w, enc, "")
 			return
 		}
-		writeRPC(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+		c.handleRPCBatch(w, r, rpcCfg, exposeInternalErrors, enc, body)
 		return
 	}
-	if err := dec.Decode(&struct{}{}); err != io.EOF {
-		writeRPC(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+
+	var req rpcRequest
+	if err := decodeRPCJSON(body, &req); err != nil {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+		return
+	}
+	if rpcCfg.WebSocket != nil && strings.TrimSpace(req.Method) == rpcWSTicketMethod {
+		c.handleRPCWebSocketTicket(w, r, enc, req)
+		return
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	}
+	m, ok := rpcCfg.Methods[strings.TrimSpace(req.Method)]
+	if int64(len(body)) > rpcMethodMaxBodyBytes(rpcCfg, m) {
+		writeRPCTooLarge(w, enc, req.ID)
+		return
+	}
+	if ok && m.Stream != nil {
+		c.serveRPCStream(w, r, rpcCfg, exposeInternalErrors, enc, req, m)
+		return
+	}
+	res := c.dispatchRPC(r.Context(), rpcCfg, exposeInternalErrors, req)
+	for k, v := range res.header {
+		w.Header()[k] = v
+	}
+	n := enc.write(w, res.status, res.resp)
+	c.recordRPCPayload(rpcCfg, req.Method, len(body), n)
+}
+
+// rpcMaxBodyBytes returns RPCConfig.MaxBodyBytes or its default.
+func rpcMaxBodyBytes(rpcCfg *api.RPCConfig) int64 {
+	if rpcCfg.MaxBodyBytes > 0 {
+		return rpcCfg.MaxBodyBytes
+	}
+	return defaultRPCMaxBodyBytes
+}
+
+// rpcMethodMaxBodyBytes returns the body limit of a single call to m.
+func rpcMethodMaxBodyBytes(rpcCfg *api.RPCConfig, m api.RPCMethod) int64 {
+	if m.MaxBodyBytes > 0 {
+		return m.MaxBodyBytes
+	}
+	return rpcMaxBodyBytes(rpcCfg)
+}
+
+// rpcReadLimit is how much of a JSON body is read before its method is known:
+// the largest limit of any method. The method's own limit is checked once the
+// request is decoded.
+func rpcReadLimit(rpcCfg *api.RPCConfig) int64 {
+	limit := rpcMaxBodyBytes(rpcCfg)
+	for _, m := range rpcCfg.Methods {
+		if !m.Upload && m.MaxBodyBytes > limit {
+			limit = m.MaxBodyBytes
+		}
+	}
+	return limit
+}
+
+func writeRPCTooLarge(w http.ResponseWriter, enc rpcEncoding, id string) {
+	enc.write(w, http.StatusRequestEntityTooLarge, rpcResponse{ID: id, Error: &rpcError{Code: "payload_too_large", Message: "request too large"}})
+}
+
+// handleRPCBatch runs every call of a batch request and answers with the
+// responses in request order. Each call is dispatched independently, so
+// permission checks and error mapping apply per call.
+func (c *Controller) handleRPCBatch(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding, body []byte) {
+	var reqs []rpcRequest
+	if err := decodeRPCJSON(body, &reqs); err != nil {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+		return
+	}
+	if len(reqs) == 0 {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "batch is empty"}})
+		return
+	}
+	maxBatch := rpcCfg.MaxBatchSize
+	if maxBatch <= 0 {
+		maxBatch = defaultRPCMaxBatchSize
+	}
+	if len(reqs) > maxBatch {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: fmt.Sprintf("batch exceeds %d calls", maxBatch)}})
 		return
 	}
+
+	ctx := r.Context()
+	results := make([]rpcResult, len(reqs))
+	if rpcCfg.BatchConcurrency <= 1 {
+		for i, req := range reqs {
+			results[i] = c.dispatchRPC(ctx, rpcCfg, exposeInternalErrors, req)
+		}
+	} else {
+		sem := make(chan struct{}, rpcCfg.BatchConcurrency)
+		var wg sync.WaitGroup
+		for i, req := range reqs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = c.dispatchRPC(ctx, rpcCfg, exposeInternalErrors, req)
+			}()
+		}
+		wg.Wait()
+	}
+
+	responses := make([]rpcResponse, len(results))
+	for i, res := range results {
+		responses[i] = res.resp
+		// Per-call headers don't apply to a batch, except that the whole
+		// response is marked deprecated if any of its calls is.
+		for _, key := range []string{"Deprecation", "Sunset"} {
+			if v := res.header.Get(key); v != "" && w.Header().Get(key) == "" {
+				w.Header().Set(key, v)
+			}
+		}
+	}
+	n := enc.write(w, http.StatusOK, responses)
+	c.recordRPCPayload(rpcCfg, rpcMetricBatchMethod, len(body), n)
+}
+
+// dispatchRPC resolves and invokes a single call and records its metrics.
+func (c *Controller) dispatchRPC(ctx context.Context, rpcCfg *api.RPCConfig, exposeInternalErrors bool, req rpcRequest) rpcResult {
+	start := time.Now()
+	spanCtx, span := c.startRPCSpan(ctx, rpcCfg, req.Method)
+	replayer := c.rpcReplayer(rpcCfg)
+	var res rpcResult
+	if replayer != nil {
+		res = c.replayRPC(spanCtx, replayer, req)
+	} else {
+		res = c.safeDispatchRPCCall(spanCtx, rpcCfg, exposeInternalErrors, req)
+	}
+	method := strings.TrimSpace(req.Method)
+	if m, ok := rpcCfg.Methods[method]; ok {
+		if m.Deprecated != nil {
+			if res.header == nil {
+				res.header = http.Header{}
+			}
+			c.noteDeprecatedRPC(method, m.Deprecated, res.header)
+		}
+		if replayer == nil {
+			c.auditRPC(ctx, method, m, req, res.resp.Error, start)
+			c.recordRPC(ctx, rpcCfg, method, m, req, res.resp, start)
+		}
+	}
+	endRPCSpan(span, res.resp.Error)
+	c.recordRPCCall(ctx, rpcCfg, req.Method, res.resp.Error, time.Since(start))
+	return res
+}
+
+// safeDispatchRPCCall runs dispatchRPCCall and turns a panic in the checks
+// before the handler (permission predicates, limiters, stores) into an
+// "internal" error for this call only.
+func (c *Controller) safeDispatchRPCCall(ctx context.Context, rpcCfg *api.RPCConfig, exposeInternalErrors bool, req rpcRequest) (res rpcResult) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := c.recovered(panicSourceRPC, rpcMethodLabel(rpcCfg, req.Method), v)
+			res = rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: panicRPCError(err, exposeInternalErrors)}}
+		}
+	}()
+	return c.dispatchRPCCall(ctx, rpcCfg, exposeInternalErrors, req)
+}
+
+func (c *Controller) dispatchRPCCall(ctx context.Context, rpcCfg *api.RPCConfig, exposeInternalErrors bool, req rpcRequest) rpcResult {
 	method := strings.TrimSpace(req.Method)
 	if method == "" {
-		writeRPC(w, http.StatusBadRequest, rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "method is required"}})
-		return
+		return rpcResult{status: http.StatusBadRequest, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "method is required"}}}
 	}
 	rpcMethod, ok := rpcCfg.Methods[method]
 	if !ok {
-		writeRPC(w, http.StatusOK, rpcResponse{ID: req.ID, Error: &rpcError{Code: "method_not_found", Message: "method not found"}})
-		return
+		return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "method_not_found", Message: "method not found"}}}
+	}
+	if rpcMethod.Stream != nil {
+		return rpcResult{status: http.StatusBadRequest, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "streaming methods cannot be batched"}}}
+	}
+	if rpcErr := c.authorizeRPC(ctx, method, rpcMethod, req.Params, exposeInternalErrors); rpcErr != nil {
+		return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: rpcErr}}
+	}
+	if retryAfter, limited := c.checkRateLimit(ctx, rpcCfg, method, rpcMethod); limited {
+		return rpcResult{
+			status: http.StatusOK,
+			resp:   rpcResponse{ID: req.ID, Error: rateLimitedError(retryAfter)},
+			header: http.Header{"Retry-After": []string{retryAfterSeconds(retryAfter)}},
+		}
+	}
+	if rpcMethod.Idempotent && strings.TrimSpace(req.IdempotencyKey) != "" {
+		return c.invokeIdempotentRPC(ctx, rpcCfg, exposeInternalErrors, method, rpcMethod, req)
+	}
+	return c.invokeRPC(ctx, rpcCfg, exposeInternalErrors, method, rpcMethod, req, nil)
+}
+
+// invokeRPC runs the method handler under the method's timeout and maps its
+// outcome to a response. The call returns as soon as its context is done, even
+// if the handler ignores cancellation. settle, when set, is called from the
+// handler's goroutine once the handler has actually returned, which may be
+// after invokeRPC did; a call abandoned that way is settled with the error the
+// caller was answered with, not with the handler's late outcome.
+func (c *Controller) invokeRPC(ctx context.Context, rpcCfg *api.RPCConfig, exposeInternalErrors bool, method string, rpcMethod api.RPCMethod, req rpcRequest, settle func(result any, err error)) rpcResult {
+	var (
+		callCtx context.Context
+		cancel  context.CancelFunc
+	)
+	if timeout := rpcTimeout(rpcCfg, rpcMethod); timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		callCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result any
+		err    error
+	}
+	const (
+		callPending int32 = iota
+		callReturned
+		callAbandoned
+	)
+	// state decides once whether the caller gets the handler's outcome or the
+	// context's error, so settle always agrees with the response.
+	var state atomic.Int32
+	done := make(chan outcome, 1)
+	handlerDone := make(chan struct{})
+	go func() {
+		defer close(handlerDone)
+		var out outcome
+		defer func() {
+			if settle != nil {
+				if state.CompareAndSwap(callPending, callReturned) {
+					settle(out.result, out.err)
+				} else {
+					settle(nil, callCtx.Err())
+				}
+			}
+			done <- out
+		}()
+		defer func() {
+			if v := recover(); v != nil {
+				out = outcome{err: c.recovered(panicSourceRPC, method, v)}
+			}
+		}()
+		out.result, out.err = rpcMethod.Handler(callCtx, req.Params)
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-callCtx.Done():
+		if state.CompareAndSwap(callPending, callAbandoned) {
+			out.err = callCtx.Err()
+		} else {
+			// The handler returned first; its outcome is on the way.
+			out = <-done
+		}
+	}
+	if out.err != nil {
+		if ctxErr := callCtx.Err(); ctxErr != nil && !errors.Is(out.err, ctxErr) {
+			// The handler failed because its context ended; report why it ended.
+			out.err = fmt.Errorf("%w: %w", ctxErr, out.err)
+		}
+		res := rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: c.rpcErrorFor(method, out.err, exposeInternalErrors)}}
+		if state.Load() == callAbandoned {
+			res.handlerDone = handlerDone
+		}
+		return res
+	}
+	return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Result: out.result}}
+}
+
+// rpcTimeout returns the timeout for rpcMethod, falling back to the config default.
+func rpcTimeout(rpcCfg *api.RPCConfig, rpcMethod api.RPCMethod) time.Duration {
+	if rpcMethod.Timeout > 0 {
+		return rpcMethod.Timeout
+	}
+	return rpcCfg.Timeout
+}
+
+// idempotentResponse is what the IdempotencyStore keeps for a completed
+// idempotent call: its result and a hash of the params it ran with.
+type idempotentResponse struct {
+	ParamsHash string `json:"paramsHash"`
+	Result     any    `json:"result,omitempty"`
+}
+
+// invokeIdempotentRPC runs an idempotent method at most once per
+// (tenant, user, method, key). A completed call's result is replayed; a call
+// that is still running makes duplicates fail with "conflict", as does reusing
+// a key with different params. Failed calls release the key so they can be
+// retried. Anonymous callers would share one key space, so their calls run
+// without idempotency.
+func (c *Controller) invokeIdempotentRPC(ctx context.Context, rpcCfg *api.RPCConfig, exposeInternalErrors bool, method string, rpcMethod api.RPCMethod, req rpcRequest) rpcResult {
+	if u, err := c.user(ctx); err != nil || u == nil {
+		return c.invokeRPC(ctx, rpcCfg, exposeInternalErrors, method, rpcMethod, req, nil)
+	}
+	store := rpcCfg.IdempotencyStore
+	if store == nil {
+		store = c.idempotency
 	}
-	if len(rpcMethod.RequirePermissions) > 0 {
-		if err := c.requirePermissions(r.Context(), rpcMethod.RequirePermissions); err != nil {
-			writeRPC(w, http.StatusOK, rpcResponse{ID: req.ID, Error: &rpcError{Code: "forbidden", Message: "permission denied"}})
+	ttl := rpcCfg.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultRPCIdempotencyTTL
+	}
+	userID, tenantID := c.callerIdentity(ctx)
+	key := strings.Join([]string{tenantID, strconv.FormatUint(uint64(userID), 10), method, strings.TrimSpace(req.IdempotencyKey)}, ":")
+	paramsHash := recording.HashParams(req.Params)
+	log := c.logger.WithField("method", method)
+
+	status, stored, err := store.Reserve(ctx, key, ttl)
+	if err != nil {
+		log.WithError(err).Warn("RPC idempotency store failed, running call without it")
+		return c.invokeRPC(ctx, rpcCfg, exposeInternalErrors, method, rpcMethod, req, nil)
+	}
+	switch status {
+	case api.IdempotencyInFlight:
+		return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "conflict", Message: "request with this idempotency key is in progress"}}}
+	case api.IdempotencyCompleted:
+		var replay idempotentResponse
+		if err := json.Unmarshal(stored, &replay); err != nil {
+			log.WithError(err).Warn("RPC idempotency store returned an unreadable response")
+			return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "internal", Message: "internal error"}}}
+		}
+		if replay.ParamsHash != paramsHash {
+			return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "conflict", Message: "idempotency key was used with different params"}}}
+		}
+		return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Result: replay.Result}, header: http.Header{"Idempotent-Replayed": []string{"true"}}}
+	case api.IdempotencyNew:
+	}
+
+	// The reservation is held until the handler returns, not until the call
+	// does: a handler still running after a timeout must keep retries out.
+	// Once it returns the key is released, as the caller was told it failed.
+	storeCtx := context.WithoutCancel(ctx)
+	settle := func(result any, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				c.recovered(panicSourceRPC, method, v)
+			}
+		}()
+		if err != nil {
+			if err := store.Release(storeCtx, key); err != nil {
+				log.WithError(err).Warn("Failed to release RPC idempotency key")
+			}
 			return
 		}
+		encoded, err := json.Marshal(idempotentResponse{ParamsHash: paramsHash, Result: result})
+		if err == nil {
+			err = store.Complete(storeCtx, key, encoded, ttl)
+		}
+		if err != nil {
+			log.WithError(err).Warn("Failed to store RPC idempotent response")
+			_ = store.Release(storeCtx, key)
+		}
+	}
+	return c.invokeRPC(ctx, rpcCfg, exposeInternalErrors, method, rpcMethod, req, settle)
+}
+
+// serveRPCStream runs a streaming method and delivers its events as SSE:
+// each event is sent as a "result" event, a failure as an "error" event
+// carrying the rpcError, and a successful end as "done". Errors that happen
+// before the stream starts are answered as a regular JSON response.
+func (c *Controller) serveRPCStream(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding, req rpcRequest, rpcMethod api.RPCMethod) {
+	start := time.Now()
+	spanCtx, span := c.startRPCSpan(r.Context(), rpcCfg, req.Method)
+	rpcErr := c.safeStreamRPC(w, r.WithContext(spanCtx), rpcCfg, exposeInternalErrors, enc, req, rpcMethod)
+	endRPCSpan(span, rpcErr)
+	c.recordRPCCall(r.Context(), rpcCfg, req.Method, rpcErr, time.Since(start))
+}
+
+// safeStreamRPC runs streamRPC and answers a panic before the stream starts
+// with an "internal" error. Panics in the stream handler itself are handled
+// by streamRPC, which sends them as an "error" event.
+func (c *Controller) safeStreamRPC(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding, req rpcRequest, rpcMethod api.RPCMethod) (rpcErr *rpcError) {
+	defer func() {
+		if v := recover(); v != nil {
+			rpcErr = panicRPCError(c.recovered(panicSourceRPC, strings.TrimSpace(req.Method), v), exposeInternalErrors)
+			enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Error: rpcErr})
+		}
+	}()
+	return c.streamRPC(w, r, rpcCfg, exposeInternalErrors, enc, req, rpcMethod)
+}
+
+// streamRPC serves a streaming call and returns the error it ended with, if any.
+func (c *Controller) streamRPC(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding, req rpcRequest, rpcMethod api.RPCMethod) *rpcError {
+	ctx := r.Context()
+	method := strings.TrimSpace(req.Method)
+	if rpcMethod.Deprecated != nil {
+		c.noteDeprecatedRPC(method, rpcMethod.Deprecated, w.Header())
+	}
+	if rpcErr := c.authorizeRPC(ctx, method, rpcMethod, req.Params, exposeInternalErrors); rpcErr != nil {
+		enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Error: rpcErr})
+		return rpcErr
+	}
+	if retryAfter, limited := c.checkRateLimit(ctx, rpcCfg, method, rpcMethod); limited {
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		rpcErr := rateLimitedError(retryAfter)
+		enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Error: rpcErr})
+		return rpcErr
 	}
-	result, err := rpcMethod.Handler(r.Context(), req.Params)
+	sw, err := stream.NewStreamWriter(w)
 	if err != nil {
-		code := mapErrorCode(err)
-		msg := mapRPCErrorMessage(code, err, exposeInternalErrors)
+		c.logger.WithField("method", method).WithError(err).Error("RPC stream unavailable")
+		rpcErr := &rpcError{Code: "internal", Message: "streaming not supported"}
+		enc.write(w, http.StatusInternalServerError, rpcResponse{ID: req.ID, Error: rpcErr})
+		return rpcErr
+	}
+	emit := func(event any) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return sw.WriteJSON("result", event)
+	}
+	if err := c.runStream(ctx, method, rpcMethod, req.Params, emit); err != nil {
+		var perr *panicError
+		if ctx.Err() != nil && !errors.As(err, &perr) {
+			return &rpcError{Code: "canceled", Message: "request canceled"}
+		}
+		rpcErr := c.rpcErrorFor(method, err, exposeInternalErrors)
+		_ = sw.WriteErrorJSON(rpcErr)
+		return rpcErr
+	}
+	_ = sw.WriteDone()
+	return nil
+}
 
-		// Always log RPC errors server-side for debuggability.
-		c.logger.WithField("method", method).WithField("code", code).WithError(err).Error("RPC handler error")
+// runStream calls the stream handler, returning a panic as a *panicError.
+func (c *Controller) runStream(ctx context.Context, method string, rpcMethod api.RPCMethod, params json.RawMessage, emit func(event any) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = c.recovered(panicSourceRPC, method, v)
+		}
+	}()
+	return rpcMethod.Stream(ctx, params, emit)
+}
 
-		rpcErr := &rpcError{
-			Code:    code,
-			Message: msg,
+// noteDeprecatedRPC logs a call to a deprecated method and sets the
+// Deprecation and Sunset (RFC 8594) headers on h.
+func (c *Controller) noteDeprecatedRPC(method string, d *api.Deprecation, h http.Header) {
+	log := c.logger.WithField("method", method)
+	h.Set("Deprecation", "true")
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		log = log.WithField("sunset", d.Sunset.UTC().Format(time.DateOnly))
+	}
+	if d.Message != "" {
+		log = log.WithField("deprecation", d.Message)
+	}
+	log.Warn("Deprecated RPC method called")
+}
+
+// authorizeRPC checks the method's permissions with api.AuthorizeMethod.
+// Failing checks answer "forbidden"; errors from custom predicates are
+// reported like handler errors.
+func (c *Controller) authorizeRPC(ctx context.Context, method string, rpcMethod api.RPCMethod, params json.RawMessage, exposeInternalErrors bool) *rpcError {
+	u, _ := c.user(ctx)
+	if err := api.AuthorizeMethod(ctx, u, rpcMethod, params); err != nil {
+		if errors.Is(err, api.ErrPermissionDenied) {
+			return &rpcError{Code: "forbidden", Message: "permission denied"}
 		}
-		if exposeInternalErrors {
-			rpcErr.Details = extractErrorDetails(err)
+		return c.rpcErrorFor(method, err, exposeInternalErrors)
+	}
+	return nil
+}
+
+// checkRateLimit applies the endpoint-wide limiter and then the method's own
+// limiter. Limiter failures are logged and let the call through.
+func (c *Controller) checkRateLimit(ctx context.Context, rpcCfg *api.RPCConfig, method string, rpcMethod api.RPCMethod) (time.Duration, bool) {
+	if rpcCfg.RateLimiter == nil && rpcMethod.RateLimiter == nil {
+		return 0, false
+	}
+	userID, tenantID := c.callerIdentity(ctx)
+	key := api.RateLimitKey{UserID: userID, TenantID: tenantID, Method: method}
+	for _, limiter := range []api.RateLimiter{rpcCfg.RateLimiter, rpcMethod.RateLimiter} {
+		if limiter == nil {
+			continue
+		}
+		decision, err := limiter.Allow(ctx, key)
+		if err != nil {
+			c.logger.WithField("method", method).WithError(err).Warn("RPC rate limiter failed, allowing call")
+			continue
+		}
+		if !decision.Allowed {
+			return decision.RetryAfter, true
 		}
-		writeRPC(w, http.StatusOK, rpcResponse{ID: req.ID, Error: rpcErr})
-		return
 	}
-	writeRPC(w, http.StatusOK, rpcResponse{ID: req.ID, Result: result})
+	return 0, false
 }
 
-func writeRPC(w http.ResponseWriter, status int, resp rpcResponse) {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.SetEscapeHTML(false)
-	if err := enc.Encode(resp); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
-		return
+// withIdentity extracts the caller's identity once and stores it in ctx for
+// permission checks and handlers. Calls without a user or tenant keep ctx as
+// is; permission checks then deny them.
+func (c *Controller) withIdentity(ctx context.Context) context.Context {
+	if _, ok := api.IdentityFrom(ctx); ok {
+		return ctx
+	}
+	id, err := appletctx.ExtractIdentity(ctx, c.host, "Controller.withIdentity", nil)
+	if err != nil || id.User == nil {
+		return ctx
+	}
+	return api.WithIdentity(ctx, id)
+}
+
+// user returns the calling user from the request identity, falling back to
+// the host for contexts that were not prepared by handleRPC.
+func (c *Controller) user(ctx context.Context) (api.AppletUser, error) {
+	if u, ok := api.UserFrom(ctx); ok {
+		return u, nil
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(status)
-	_, _ = w.Write(buf.Bytes())
+	return c.host.ExtractUser(ctx)
+}
+
+// callerIdentity returns the calling user's ID and tenant ID, or zero values
+// when the host cannot resolve them.
+func (c *Controller) callerIdentity(ctx context.Context) (uint, string) {
+	if id, ok := api.IdentityFrom(ctx); ok {
+		return id.User.ID(), id.TenantID.String()
+	}
+	var (
+		userID   uint
+		tenantID string
+	)
+	if u, err := c.host.ExtractUser(ctx); err == nil && u != nil {
+		userID = u.ID()
+	}
+	if tid, err := c.host.ExtractTenantID(ctx); err == nil {
+		tenantID = tid.String()
+	}
+	return userID, tenantID
+}
+
+func rateLimitedError(retryAfter time.Duration) *rpcError {
+	return &rpcError{
+		Code:    "rate_limited",
+		Message: "rate limit exceeded",
+		Details: map[string]any{"retryAfterMs": retryAfter.Milliseconds()},
+	}
+}
+
+// retryAfterSeconds formats a Retry-After header value, rounded up to whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int64(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
+// rpcErrorFor maps a handler error to the client-facing rpcError and logs it.
+func (c *Controller) rpcErrorFor(method string, err error, exposeInternalErrors bool) *rpcError {
+	// Panics are logged with their stack when recovered.
+	var perr *panicError
+	if errors.As(err, &perr) {
+		return panicRPCError(perr, exposeInternalErrors)
+	}
+
+	// Domain errors carry their own client-safe message and details.
+	var coded *api.CodedError
+	if errors.As(err, &coded) && coded.Code != "" {
+		c.logger.WithField("method", method).WithField("code", coded.Code).WithError(err).Info("RPC handler returned domain error")
+		rpcErr := &rpcError{Code: coded.Code, Message: coded.Message, Details: coded.Details}
+		if rpcErr.Message == "" {
+			rpcErr.Message = mapRPCErrorMessage(coded.Code, nil, false)
+		}
+		return rpcErr
+	}
+
+	code := mapErrorCode(err)
+	msg := mapRPCErrorMessage(code, err, exposeInternalErrors)
+
+	// Always log RPC errors server-side for debuggability.
+	log := c.logger.WithField("method", method).WithField("code", code).WithError(err)
+	switch code {
+	case "canceled":
+		log.Info("RPC call canceled by client")
+	case "timeout":
+		log.Warn("RPC handler timed out")
+	default:
+		log.Error("RPC handler error")
+	}
+
+	rpcErr := &rpcError{
+		Code:    code,
+		Message: msg,
+	}
+	if details := buildErrorDetails(err, exposeInternalErrors); details != nil {
+		rpcErr.Details = details
+	}
+	return rpcErr
+}
+
+// isBatchRequest reports whether the body is a JSON array of calls.
+func isBatchRequest(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// decodeRPCJSON strictly decodes exactly one JSON value from data.
+func decodeRPCJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("decodeRPCJSON: %w: trailing data after request", api.ErrInvalid)
+	}
+	return nil
 }
 
 func mapErrorCode(err error) string {
@@ -128,6 +740,16 @@ func mapErrorCode(err error) string {
 		return "forbidden"
 	case errors.Is(err, api.ErrInternal):
 		return "internal"
+	case errors.Is(err, api.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, api.ErrConflict):
+		return "conflict"
+	case errors.Is(err, api.ErrPayloadTooLarge):
+		return "payload_too_large"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
 	}
 
 	// 2. Check for ErrorClassifier interface (e.g. serrors.Error with Kind).
@@ -158,11 +780,39 @@ func mapRPCErrorMessage(code string, err error, exposeInternalErrors bool) strin
 		return "resource not found"
 	case "internal":
 		return "internal error"
+	case "rate_limited":
+		return "rate limit exceeded"
+	case "conflict":
+		return "conflict"
+	case "payload_too_large":
+		return "request too large"
+	case "timeout":
+		return "request timed out"
+	case "canceled":
+		return "request canceled"
 	default:
 		return "request failed"
 	}
 }
 
+// buildErrorDetails returns the details to send for err. Internal details are
+// only included when exposeInternalErrors is true; field-level validation
+// errors are always included so clients can map them to inputs.
+func buildErrorDetails(err error, exposeInternalErrors bool) map[string]any {
+	var details map[string]any
+	if exposeInternalErrors {
+		details = extractErrorDetails(err)
+	}
+	var verr *api.ValidationError
+	if errors.As(err, &verr) && len(verr.Fields) > 0 {
+		if details == nil {
+			details = make(map[string]any)
+		}
+		details["fields"] = verr.Fields
+	}
+	return details
+}
+
 // extractErrorDetails builds a structured details map from the error chain.
 // This is returned in the RPC response only when ExposeInternalErrors is true.
 func extractErrorDetails(err error) map[string]any {
@@ -194,20 +844,27 @@ func extractErrorDetails(err error) map[string]any {
 }
 
 func (c *Controller) requirePermissions(ctx context.Context, required []string) error {
-	u, err := c.host.ExtractUser(ctx)
+	u, err := c.user(ctx)
 	if err != nil {
 		return fmt.Errorf("requirePermissions: %w", err)
 	}
 	if u == nil {
 		return fmt.Errorf("requirePermissions: no user: %w", api.ErrPermissionDenied)
 	}
-	for _, need := range required {
-		if need == "" {
-			continue
-		}
-		if !u.HasPermission(need) {
-			return fmt.Errorf("requirePermissions: missing permission %q: %w", need, api.ErrPermissionDenied)
-		}
+	if err := api.RequirePermissions(u, required); err != nil {
+		return fmt.Errorf("requirePermissions: %w", err)
+	}
+	return nil
+}
+
+// checkPermission evaluates expr for the current user. A nil expr allows.
+func (c *Controller) checkPermission(ctx context.Context, expr api.PermissionExpr, params json.RawMessage) error {
+	if expr == nil {
+		return nil
+	}
+	u, _ := c.user(ctx)
+	if err := api.CheckPermission(ctx, u, expr, params); err != nil {
+		return fmt.Errorf("checkPermission: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	_ "embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// rpcPlaygroundPath is where the RPC playground is served in dev mode,
+// relative to the applet base path.
+const rpcPlaygroundPath = "/__playground"
+
+// rpcPlaygroundEndpoint is the RPC endpoint the playground calls; it matches
+// the RPCUIEndpoint given to the applet frontend.
+const rpcPlaygroundEndpoint = "/rpc"
+
+//go:embed playground.html
+var playgroundHTML string
+
+var playgroundTemplate = template.Must(template.New("playground").Parse(playgroundHTML))
+
+type playgroundData struct {
+	Title       string
+	Endpoint    string
+	CSRFToken   string
+	Description *api.TypedRouterDescription
+}
+
+// handleRPCPlayground serves a page for calling the applet's procedures by
+// hand. It is only registered while the dev proxy is enabled and calls the
+// live endpoint with the current user's session and CSRF token.
+func (c *Controller) handleRPCPlayground(w http.ResponseWriter, r *http.Request) {
+	rpcCfg := c.applet.Config().RPC
+	if c.devAssets == nil || rpcCfg == nil || rpcCfg.Describe == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := c.checkPermission(r.Context(), c.applet.Config().Permissions, nil); err != nil {
+		if errors.Is(err, api.ErrPermissionDenied) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		c.logger.WithError(err).Error("failed to check applet permissions")
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
+	desc, err := rpcCfg.Describe()
+	if err != nil {
+		c.logger.WithError(err).Error("failed to describe RPC router")
+		http.Error(w, "Failed to describe RPC router", http.StatusInternalServerError)
+		return
+	}
+	title := strings.TrimSpace(c.applet.Config().Shell.Title)
+	if title == "" {
+		title = c.applet.Name()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := playgroundTemplate.Execute(w, playgroundData{
+		Title:       title,
+		Endpoint:    rpcPlaygroundEndpoint,
+		CSRFToken:   csrf.Token(r),
+		Description: desc,
+	}); err != nil {
+		c.logger.WithError(err).Error("failed to render RPC playground")
+	}
+}
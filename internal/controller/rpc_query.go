@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const defaultRPCQueryCacheControl = "private, no-cache"
+
+// handleRPCQuery serves GET calls to query methods:
+// GET <rpc path>?method=<name>&params=<url-encoded json>[&id=<id>].
+// Successful responses carry an ETag of the result and the method's
+// Cache-Control policy, made private when the caller has a user; a matching
+// If-None-Match is answered with 304.
+func (c *Controller) handleRPCQuery(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding) {
+	q := r.URL.Query()
+	req := rpcRequest{ID: q.Get("id"), Method: q.Get("method")}
+	if raw := q.Get("params"); raw != "" {
+		if !json.Valid([]byte(raw)) {
+			writeRPCNoStore(w, enc, http.StatusBadRequest, rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "params must be JSON"}})
+			return
+		}
+		req.Params = json.RawMessage(raw)
+	}
+	if m, ok := rpcCfg.Methods[strings.TrimSpace(req.Method)]; ok && !m.Query {
+		w.Header().Set("Allow", http.MethodPost)
+		writeRPCNoStore(w, enc, http.StatusMethodNotAllowed, rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "method must be called with POST"}})
+		return
+	}
+
+	res := c.dispatchRPC(r.Context(), rpcCfg, exposeInternalErrors, req)
+	for k, v := range res.header {
+		w.Header()[k] = v
+	}
+	if res.resp.Error != nil {
+		writeRPCNoStore(w, enc, res.status, res.resp)
+		return
+	}
+
+	result, err := encodeRPCJSON(res.resp.Result)
+	if err != nil {
+		c.logger.WithField("method", req.Method).WithError(err).Error("Failed to encode RPC query result")
+		writeRPCNoStore(w, enc, http.StatusInternalServerError, rpcResponse{ID: req.ID, Error: &rpcError{Code: "internal", Message: "internal error"}})
+		return
+	}
+	etag := rpcETag(result)
+	cacheControl := rpcCfg.Methods[strings.TrimSpace(req.Method)].CacheControl
+	if cacheControl == "" {
+		cacheControl = defaultRPCQueryCacheControl
+	}
+	if u, err := c.user(r.Context()); err == nil && u != nil {
+		// The result was computed for this user: keep it out of shared caches.
+		cacheControl = privateCacheControl(cacheControl)
+		w.Header().Add("Vary", "Cookie")
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		// A 304 carries the same Vary as the 200 it revalidates.
+		w.Header().Add("Vary", rpcVary)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Result: json.RawMessage(result)})
+}
+
+// privateCacheControl rewrites a Cache-Control value for a response that
+// depends on the caller: "public" and "s-maxage" are dropped and "private" is
+// added unless the response is not stored at all.
+func privateCacheControl(cacheControl string) string {
+	var directives []string
+	private := false
+	for _, d := range strings.Split(cacheControl, ",") {
+		d = strings.TrimSpace(d)
+		name, _, _ := strings.Cut(strings.ToLower(d), "=")
+		switch name {
+		case "", "public", "s-maxage":
+			continue
+		case "private", "no-store":
+			private = true
+		}
+		directives = append(directives, d)
+	}
+	if !private {
+		directives = append([]string{"private"}, directives...)
+	}
+	return strings.Join(directives, ", ")
+}
+
+// writeRPCNoStore writes an uncacheable response.
+func writeRPCNoStore(w http.ResponseWriter, enc rpcEncoding, status int, resp rpcResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	enc.write(w, status, resp)
+}
+
+// rpcETag returns an ETag for an encoded result. It is weak because the same
+// result may be sent with different codecs and compression.
+func rpcETag(result []byte) string {
+	sum := sha256.Sum256(result)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using weak comparison as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/iota-uz/applets/internal/recording"
+)
+
+// recordRPC sends a completed call to the RPC recorder. Recorder failures are
+// logged and do not affect the response.
+func (c *Controller) recordRPC(ctx context.Context, rpcCfg *api.RPCConfig, method string, rpcMethod api.RPCMethod, req rpcRequest, resp rpcResponse, start time.Time) {
+	if rpcCfg.Recorder == nil {
+		return
+	}
+	rec := api.RPCRecord{
+		Time:       start,
+		Method:     method,
+		ParamsHash: recording.HashParams(req.Params),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	var params any = req.Params
+	if rpcMethod.RedactParams != nil {
+		params = rpcMethod.RedactParams(req.Params)
+	}
+	rec.Params = marshalRecorded(params)
+	if resp.Error != nil {
+		rec.Error = &api.RPCRecordError{Code: resp.Error.Code, Message: resp.Error.Message, Details: marshalRecorded(resp.Error.Details)}
+	} else {
+		result := resp.Result
+		if rpcMethod.RedactResult != nil {
+			result = rpcMethod.RedactResult(result)
+		}
+		rec.Result = marshalRecorded(result)
+	}
+	if err := rpcCfg.Recorder.Record(ctx, rec); err != nil {
+		c.logger.WithField("method", method).WithError(err).Error("Failed to record RPC call")
+	}
+}
+
+// rpcReplayer returns RPCConfig.Replayer while the dev proxy is enabled.
+// Replayed calls skip permission checks and limiters, so the replayer is
+// never used outside development; New warns when it is configured there.
+func (c *Controller) rpcReplayer(rpcCfg *api.RPCConfig) api.RPCReplayer {
+	if c.devAssets == nil {
+		return nil
+	}
+	return rpcCfg.Replayer
+}
+
+// replayRPC answers a call with its recorded response.
+func (c *Controller) replayRPC(ctx context.Context, replayer api.RPCReplayer, req rpcRequest) rpcResult {
+	method := strings.TrimSpace(req.Method)
+	rec, ok := replayer.Replay(ctx, method, recording.HashParams(req.Params))
+	if !ok {
+		return rpcResult{status: http.StatusOK, resp: rpcResponse{ID: req.ID, Error: &rpcError{Code: "not_found", Message: "no recorded response"}}}
+	}
+	resp := rpcResponse{ID: req.ID}
+	if rec.Error != nil {
+		resp.Error = &rpcError{Code: rec.Error.Code, Message: rec.Error.Message, Details: unmarshalRecorded(rec.Error.Details)}
+	} else {
+		resp.Result = unmarshalRecorded(rec.Result)
+	}
+	return rpcResult{status: http.StatusOK, resp: resp}
+}
+
+// marshalRecorded encodes v for an RPCRecord, or returns nil when v is empty
+// or cannot be encoded.
+func marshalRecorded(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok && len(raw) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// unmarshalRecorded decodes a recorded value into generic JSON values, so any
+// negotiated codec can encode it.
+func unmarshalRecorded(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/iota-uz/applets/internal/tracing"
+)
+
+const (
+	rpcMetricDuration      = "applet.rpc.duration"
+	rpcMetricCalls         = "applet.rpc.calls"
+	rpcMetricRequestBytes  = "applet.rpc.request_bytes"
+	rpcMetricResponseBytes = "applet.rpc.response_bytes"
+
+	rpcMetricUnknownMethod = "unknown"
+	rpcMetricBatchMethod   = "batch"
+	rpcMetricOtherCode     = "other"
+)
+
+// rpcMetricCodes bounds the "code" label together with RPCConfig.ErrorCodes.
+// Codes from ErrorClassifier kinds are free-form, so anything not listed in
+// either is recorded as "other".
+var rpcMetricCodes = map[string]struct{}{
+	"ok": {}, "invalid_request": {}, "method_not_found": {}, "payload_too_large": {},
+	"forbidden": {}, "validation": {}, "invalid": {}, "not_found": {}, "internal": {},
+	"rate_limited": {}, "conflict": {}, "timeout": {}, "canceled": {},
+}
+
+// recordRPCCall records the duration and outcome of one call.
+func (c *Controller) recordRPCCall(ctx context.Context, rpcCfg *api.RPCConfig, method string, rpcErr *rpcError, duration time.Duration) {
+	if c.metrics == nil {
+		return
+	}
+	code := "ok"
+	if rpcErr != nil {
+		code = rpcErr.Code
+	}
+	if _, ok := rpcMetricCodes[code]; !ok && !slices.Contains(rpcCfg.ErrorCodes, code) {
+		code = rpcMetricOtherCode
+	}
+	tenantID := ""
+	if tid, ok := api.TenantIDFrom(ctx); ok {
+		tenantID = tid.String()
+	} else if tid, err := c.host.ExtractTenantID(ctx); err == nil {
+		tenantID = tid.String()
+	}
+	labels := map[string]string{
+		"applet":    c.applet.Name(),
+		"method":    rpcMethodLabel(rpcCfg, method),
+		"code":      code,
+		"tenant_id": tenantID,
+	}
+	c.metrics.RecordDuration(rpcMetricDuration, duration, labels)
+	c.metrics.IncrementCounter(rpcMetricCalls, labels)
+}
+
+// recordRPCPayload records request and response body sizes when the metrics
+// recorder implements api.ValueRecorder. method is a method name or
+// rpcMetricBatchMethod.
+func (c *Controller) recordRPCPayload(rpcCfg *api.RPCConfig, method string, requestBytes, responseBytes int) {
+	recorder, ok := c.metrics.(api.ValueRecorder)
+	if !ok {
+		return
+	}
+	if method != rpcMetricBatchMethod {
+		method = rpcMethodLabel(rpcCfg, method)
+	}
+	labels := map[string]string{"applet": c.applet.Name(), "method": method}
+	recorder.RecordValue(rpcMetricRequestBytes, float64(requestBytes), labels)
+	recorder.RecordValue(rpcMetricResponseBytes, float64(responseBytes), labels)
+}
+
+// rpcMethodLabel returns method if it is registered, so arbitrary client input
+// cannot create new label values.
+func rpcMethodLabel(rpcCfg *api.RPCConfig, method string) string {
+	method = strings.TrimSpace(method)
+	if _, ok := rpcCfg.Methods[method]; !ok {
+		return rpcMetricUnknownMethod
+	}
+	return method
+}
+
+// startRPCSpan starts the span for one call. Unknown methods share one
+// attribute value, like the metrics labels.
+func (c *Controller) startRPCSpan(ctx context.Context, rpcCfg *api.RPCConfig, method string) (context.Context, api.Span) {
+	return tracing.Start(ctx, c.tracer, "applet.rpc", map[string]string{tracing.AttrMethod: rpcMethodLabel(rpcCfg, method)})
+}
+
+// endRPCSpan records rpcErr, if any, with its mapped code and ends span.
+func endRPCSpan(span api.Span, rpcErr *rpcError) {
+	if rpcErr != nil {
+		span.SetAttribute(tracing.AttrErrorCode, rpcErr.Code)
+		span.RecordError(rpcErr)
+	}
+	span.End()
+}
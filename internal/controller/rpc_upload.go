@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const defaultRPCUploadMaxBytes = 32 << 20
+
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// handleRPCUpload serves a call to an upload method. The first part holds the
+// call as JSON; the remaining parts are handed to the method as UploadFiles
+// and read straight from the request body while the handler runs. Because the
+// handler reads the body, the response waits for it to return even after a
+// timeout; files read after that fail with errUploadEnded. Bodies may be
+// compressed like any other RPC body.
+func (c *Controller) handleRPCUpload(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool, enc rpcEncoding) {
+	_, mediaParams, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	boundary := mediaParams["boundary"]
+	if boundary == "" {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "multipart boundary is missing"}})
+		return
+	}
+	var src io.Reader = r.Body
+	if encoding := strings.TrimSpace(r.Header.Get("Content-Encoding")); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		comp := findCompressor(rpcCfg, encoding)
+		if comp == nil {
+			enc.write(w, http.StatusUnsupportedMediaType, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: errRPCUnsupportedEncoding.Error()}})
+			return
+		}
+		zr, err := comp.NewReader(r.Body)
+		if err != nil {
+			enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid compressed body"}})
+			return
+		}
+		defer func() { _ = zr.Close() }()
+		src = zr
+	}
+	body := &limitedUpload{r: src, limit: rpcMaxBodyBytes(rpcCfg), what: "request body"}
+	mr := multipart.NewReader(body, boundary)
+	part, err := mr.NextPart()
+	if err == nil && part.FormName() != "request" {
+		err = errors.New("first part is not the request")
+	}
+	var data []byte
+	if err == nil {
+		data, err = io.ReadAll(part)
+	}
+	if err != nil {
+		if errors.Is(err, api.ErrPayloadTooLarge) {
+			writeRPCTooLarge(w, enc, "")
+			return
+		}
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "upload must start with a request part"}})
+		return
+	}
+	var req rpcRequest
+	if err := decodeRPCJSON(data, &req); err != nil {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+		return
+	}
+	m, ok := rpcCfg.Methods[strings.TrimSpace(req.Method)]
+	if ok && !m.Upload {
+		enc.write(w, http.StatusBadRequest, rpcResponse{ID: req.ID, Error: &rpcError{Code: "invalid_request", Message: "method does not accept uploads"}})
+		return
+	}
+	body.limit = defaultRPCUploadMaxBytes
+	if m.MaxBodyBytes > 0 {
+		body.limit = m.MaxBodyBytes
+	}
+	files := &uploadFiles{mr: mr, maxFileBytes: m.MaxFileBytes, allowedTypes: m.AllowedTypes}
+
+	res := c.dispatchRPC(api.WithUploadFiles(r.Context(), files), rpcCfg, exposeInternalErrors, req)
+	if res.handlerDone != nil {
+		// The body may not be read once the response is written.
+		files.end()
+		<-res.handlerDone
+	}
+	for k, v := range res.header {
+		w.Header()[k] = v
+	}
+	n := enc.write(w, res.status, res.resp)
+	c.recordRPCPayload(rpcCfg, req.Method, int(body.read), n)
+}
+
+// errUploadEnded is returned when a handler reads files after its call ended.
+var errUploadEnded = errors.New("upload call has ended")
+
+// uploadFiles implements api.UploadFiles over the parts after the request.
+type uploadFiles struct {
+	mr           *multipart.Reader
+	maxFileBytes int64
+	allowedTypes []string
+	ended        atomic.Bool
+}
+
+// end makes further reads fail with errUploadEnded.
+func (f *uploadFiles) end() { f.ended.Store(true) }
+
+func (f *uploadFiles) Next() (*api.UploadFile, error) {
+	if f.ended.Load() {
+		return nil, errUploadEnded
+	}
+	part, err := f.mr.NextPart()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		if errors.Is(err, api.ErrPayloadTooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: invalid multipart body: %w", api.ErrInvalid, err)
+	}
+	contentType := part.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: file %q: invalid content type %q", api.ErrInvalid, part.FileName(), contentType)
+	}
+	if !mediaTypeAllowed(f.allowedTypes, mediaType) {
+		return nil, fmt.Errorf("%w: file %q: content type %q is not allowed", api.ErrInvalid, part.FileName(), mediaType)
+	}
+	var body io.Reader = part
+	if f.maxFileBytes > 0 {
+		body = &limitedUpload{r: part, limit: f.maxFileBytes, what: fmt.Sprintf("file %q", part.FileName())}
+	}
+	return &api.UploadFile{
+		Field:       part.FormName(),
+		Filename:    part.FileName(),
+		ContentType: mediaType,
+		Body:        &uploadFileBody{files: f, r: body},
+	}, nil
+}
+
+// uploadFileBody is a file's body that stops reading once the call ended.
+type uploadFileBody struct {
+	files *uploadFiles
+	r     io.Reader
+}
+
+func (b *uploadFileBody) Read(p []byte) (int, error) {
+	if b.files.ended.Load() {
+		return 0, errUploadEnded
+	}
+	return b.r.Read(p)
+}
+
+// mediaTypeAllowed matches mediaType against patterns such as "text/csv" or
+// "image/*". No patterns allow any type.
+func mediaTypeAllowed(patterns []string, mediaType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*/*" || p == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedUpload reads from r and fails with api.ErrPayloadTooLarge once more
+// than limit bytes have been read.
+type limitedUpload struct {
+	r     io.Reader
+	limit int64
+	read  int64
+	what  string
+}
+
+func (l *limitedUpload) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, l.tooLarge()
+	}
+	if rest := l.limit - l.read + 1; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), l.tooLarge()
+	}
+	return n, err
+}
+
+func (l *limitedUpload) tooLarge() error {
+	return fmt.Errorf("%w: %s exceeds %d bytes", api.ErrPayloadTooLarge, l.what, l.limit)
+}
@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/websocket"
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const (
+	defaultWSMaxConcurrentCalls = 16
+	defaultWSPingInterval       = 30 * time.Second
+	// wsWriteTimeout bounds every write, so a client that stops reading
+	// fails its calls instead of blocking them.
+	wsWriteTimeout = 10 * time.Second
+	wsTicketParam  = "ticket"
+	// rpcWSTicketMethod is the built-in method that issues WebSocket tickets.
+	rpcWSTicketMethod = "__wsTicket"
+	wsTicketTTL       = 30 * time.Second
+)
+
+// wsUpgrader upgrades RPC WebSocket requests. Origins are checked by
+// handleRPCWebSocket before upgrading.
+var wsUpgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	CheckOrigin:      func(*http.Request) bool { return true },
+}
+
+type wsEvent struct {
+	ID    string `json:"id"`
+	Event any    `json:"event"`
+}
+
+type wsDone struct {
+	ID   string `json:"id"`
+	Done bool   `json:"done"`
+}
+
+type wsNotification struct {
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+type wsTicketResult struct {
+	Ticket string `json:"ticket"`
+}
+
+// rpcConn is the api.RPCConnection of one WebSocket connection.
+type rpcConn struct {
+	conn *websocket.Conn
+	ctx  context.Context
+	// writeMu serializes writes; the connection allows one writer at a time.
+	writeMu sync.Mutex
+}
+
+func (rc *rpcConn) Notify(method string, params any) error {
+	if rc.ctx.Err() != nil {
+		return net.ErrClosed
+	}
+	return rc.writeJSON(wsNotification{Method: method, Params: params})
+}
+
+func (rc *rpcConn) Done() <-chan struct{} { return rc.ctx.Done() }
+
+func (rc *rpcConn) writeJSON(v any) error {
+	data, err := encodeRPCJSON(v)
+	if err != nil {
+		return err
+	}
+	return rc.write(data)
+}
+
+func (rc *rpcConn) write(data []byte) error {
+	rc.writeMu.Lock()
+	defer rc.writeMu.Unlock()
+	if err := rc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return rc.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// closeWith sends a close frame with code and reason.
+func (rc *rpcConn) closeWith(code int, reason string) {
+	_ = rc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+}
+
+// handleRPCWebSocket upgrades the request and serves calls from the
+// connection until it closes. Origin, ticket and identity are checked once
+// here; every call still goes through the regular permission checks.
+func (c *Controller) handleRPCWebSocket(w http.ResponseWriter, r *http.Request, rpcCfg *api.RPCConfig, exposeInternalErrors bool) {
+	wsCfg := rpcCfg.WebSocket
+	log := c.logger.WithField("transport", "websocket")
+	if !allowedWebSocketOrigin(r, wsCfg.AllowedOrigins) {
+		log.WithField("origin", r.Header.Get("Origin")).Warn("Rejected RPC WebSocket from disallowed origin")
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	u, err := c.user(r.Context())
+	if err != nil || u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if csrf.Token(r) != "" && !c.wsTickets.redeem(r.URL.Query().Get(wsTicketParam), u.ID(), time.Now()) {
+		http.Error(w, "invalid ticket", http.StatusForbidden)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, http.Header{requestIDHeader: {requestIDFrom(r.Context())}})
+	if err != nil {
+		// The upgrader has already answered the request.
+		log.WithError(err).Warn("RPC WebSocket upgrade failed")
+		return
+	}
+	maxMessageBytes := wsCfg.MaxMessageBytes
+	if maxMessageBytes <= 0 {
+		maxMessageBytes = rpcMaxBodyBytes(rpcCfg)
+	}
+	conn.SetReadLimit(maxMessageBytes)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	rc := &rpcConn{conn: conn, ctx: ctx}
+	ctx = api.WithRPCConnection(ctx, rc)
+	rc.ctx = ctx
+
+	var calls sync.WaitGroup
+	defer func() {
+		cancel()
+		// Closing the connection first fails writes of calls still running,
+		// so waiting for them cannot hang on a client that stopped reading.
+		rc.closeWith(websocket.CloseNormalClosure, "")
+		_ = conn.Close()
+		calls.Wait()
+	}()
+
+	// Pings keep the connection alive: a client that answers none within two
+	// intervals is dropped.
+	interval := wsPingInterval(wsCfg)
+	extendReadDeadline := func() error {
+		if interval <= 0 {
+			return nil
+		}
+		return conn.SetReadDeadline(time.Now().Add(2 * interval))
+	}
+	if interval > 0 {
+		conn.SetPongHandler(func(string) error { return extendReadDeadline() })
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+	if wsCfg.OnConnect != nil {
+		c.wsOnConnect(ctx, wsCfg, rc)
+	}
+
+	maxCalls := wsCfg.MaxConcurrentCalls
+	if maxCalls <= 0 {
+		maxCalls = defaultWSMaxConcurrentCalls
+	}
+	sem := make(chan struct{}, maxCalls)
+	for {
+		if err := extendReadDeadline(); err != nil {
+			return
+		}
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if op != websocket.TextMessage {
+			rc.closeWith(websocket.ClosePolicyViolation, "only text messages are supported")
+			return
+		}
+		var req rpcRequest
+		if err := decodeRPCJSON(data, &req); err != nil {
+			_ = rc.writeJSON(rpcResponse{ID: "", Error: &rpcError{Code: "invalid_request", Message: "invalid json request"}})
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			defer func() { <-sem }()
+			c.serveWebSocketCall(ctx, rc, rpcCfg, exposeInternalErrors, req, len(data))
+		}()
+	}
+}
+
+// handleRPCWebSocketTicket answers a call to rpcWSTicketMethod with a ticket
+// for opening a WebSocket as the caller. It is a regular POST, so the host's
+// CSRF protection covers it like any other call.
+func (c *Controller) handleRPCWebSocketTicket(w http.ResponseWriter, r *http.Request, enc rpcEncoding, req rpcRequest) {
+	w.Header().Set("Cache-Control", "no-store")
+	u, err := c.user(r.Context())
+	if err != nil || u == nil {
+		enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Error: &rpcError{Code: "forbidden", Message: "permission denied"}})
+		return
+	}
+	ticket, err := c.wsTickets.issue(u.ID(), time.Now())
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to issue RPC WebSocket ticket")
+		enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Error: &rpcError{Code: "internal", Message: "internal error"}})
+		return
+	}
+	enc.write(w, http.StatusOK, rpcResponse{ID: req.ID, Result: wsTicketResult{Ticket: ticket}})
+}
+
+// wsOnConnect runs the OnConnect hook, recovering panics like a call would.
+func (c *Controller) wsOnConnect(ctx context.Context, wsCfg *api.RPCWebSocketConfig, rc *rpcConn) {
+	defer func() {
+		if v := recover(); v != nil {
+			c.recovered(panicSourceRPC, "", v)
+		}
+	}()
+	wsCfg.OnConnect(ctx, rc)
+}
+
+// serveWebSocketCall runs one call from a connection and writes its response.
+func (c *Controller) serveWebSocketCall(ctx context.Context, rc *rpcConn, rpcCfg *api.RPCConfig, exposeInternalErrors bool, req rpcRequest, requestBytes int) {
+	ctx = context.WithValue(ctx, requestIDKey{}, uuid.NewString())
+	defer func() {
+		if v := recover(); v != nil {
+			err := c.recovered(panicSourceRPC, rpcMethodLabel(rpcCfg, req.Method), v)
+			_ = rc.writeJSON(rpcResponse{ID: req.ID, Error: panicRPCError(err, exposeInternalErrors)})
+		}
+	}()
+	if m, ok := rpcCfg.Methods[strings.TrimSpace(req.Method)]; ok && m.Stream != nil {
+		start := time.Now()
+		spanCtx, span := c.startRPCSpan(ctx, rpcCfg, req.Method)
+		rpcErr := c.streamWebSocketRPC(spanCtx, rc, rpcCfg, exposeInternalErrors, req, m)
+		endRPCSpan(span, rpcErr)
+		c.recordRPCCall(ctx, rpcCfg, req.Method, rpcErr, time.Since(start))
+		return
+	}
+	res := c.dispatchRPC(ctx, rpcCfg, exposeInternalErrors, req)
+	data, err := encodeRPCJSON(res.resp)
+	if err != nil {
+		data, _ = encodeRPCJSON(rpcResponse{ID: req.ID, Error: &rpcError{Code: "internal", Message: "failed to encode response"}})
+	}
+	if err := rc.write(data); err == nil {
+		c.recordRPCPayload(rpcCfg, req.Method, requestBytes, len(data))
+	}
+}
+
+// streamWebSocketRPC serves a streaming call over the connection and returns
+// the error it ended with, if any.
+func (c *Controller) streamWebSocketRPC(ctx context.Context, rc *rpcConn, rpcCfg *api.RPCConfig, exposeInternalErrors bool, req rpcRequest, rpcMethod api.RPCMethod) *rpcError {
+	method := strings.TrimSpace(req.Method)
+	if rpcMethod.Deprecated != nil {
+		c.noteDeprecatedRPC(method, rpcMethod.Deprecated, http.Header{})
+	}
+	fail := func(rpcErr *rpcError) *rpcError {
+		_ = rc.writeJSON(rpcResponse{ID: req.ID, Error: rpcErr})
+		return rpcErr
+	}
+	if rpcErr := c.authorizeRPC(ctx, method, rpcMethod, req.Params, exposeInternalErrors); rpcErr != nil {
+		return fail(rpcErr)
+	}
+	if retryAfter, limited := c.checkRateLimit(ctx, rpcCfg, method, rpcMethod); limited {
+		return fail(rateLimitedError(retryAfter))
+	}
+	emit := func(event any) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return rc.writeJSON(wsEvent{ID: req.ID, Event: event})
+	}
+	if err := c.runStream(ctx, method, rpcMethod, req.Params, emit); err != nil {
+		var perr *panicError
+		if ctx.Err() != nil && !errors.As(err, &perr) {
+			return &rpcError{Code: "canceled", Message: "request canceled"}
+		}
+		return fail(c.rpcErrorFor(method, err, exposeInternalErrors))
+	}
+	_ = rc.writeJSON(wsDone{ID: req.ID, Done: true})
+	return nil
+}
+
+func wsPingInterval(wsCfg *api.RPCWebSocketConfig) time.Duration {
+	if wsCfg.PingInterval == 0 {
+		return defaultWSPingInterval
+	}
+	return wsCfg.PingInterval
+}
+
+// allowedWebSocketOrigin reports whether the request's Origin is its own host
+// or one of allowed. Requests without Origin come from non-browser clients,
+// which cross-site requests cannot be forged from, and are allowed.
+func allowedWebSocketOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(strings.TrimSpace(a), "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsTickets holds the single-use tickets that authorize WebSocket upgrades
+// while the host uses CSRF protection. Browsers cannot set headers on the
+// handshake, so a page first obtains a ticket with a CSRF-protected POST and
+// passes it in the URL. Tickets are kept in memory: with several instances,
+// the upgrade must reach the instance that issued the ticket.
+type wsTickets struct {
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+type wsTicket struct {
+	userID  uint
+	expires time.Time
+}
+
+// issue returns a new ticket for userID that expires after wsTicketTTL.
+func (t *wsTickets) issue(userID uint, now time.Time) (string, error) {
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(raw[:])
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tickets == nil {
+		t.tickets = make(map[string]wsTicket)
+	}
+	for k, v := range t.tickets {
+		if now.After(v.expires) {
+			delete(t.tickets, k)
+		}
+	}
+	t.tickets[ticket] = wsTicket{userID: userID, expires: now.Add(wsTicketTTL)}
+	return ticket, nil
+}
+
+// redeem consumes ticket and reports whether it was issued to userID and has
+// not expired.
+func (t *wsTickets) redeem(ticket string, userID uint, now time.Time) bool {
+	if ticket == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.tickets[ticket]
+	delete(t.tickets, ticket)
+	return ok && v.userID == userID && !now.After(v.expires)
+}
@@ -0,0 +1,82 @@
+// Package idempotency provides the in-memory idempotency store for applet RPC.
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	done     bool
+	response []byte
+	expires  time.Time
+}
+
+// MemoryStore is an in-process api.IdempotencyStore. Keys are only shared
+// within one process, so hosts running several replicas should plug in a
+// shared store instead.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+var _ api.IdempotencyStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, ttl time.Duration) (api.IdempotencyStatus, []byte, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.done {
+			return api.IdempotencyCompleted, e.response, nil
+		}
+		return api.IdempotencyInFlight, nil, nil
+	}
+	s.entries[key] = &entry{expires: now.Add(ttl)}
+	return api.IdempotencyNew, nil, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key string, response []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &entry{done: true, response: response, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries. Callers must hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
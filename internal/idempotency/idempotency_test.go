@@ -0,0 +1,44 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	status, _, err := s.Reserve(ctx, "k", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, api.IdempotencyNew, status)
+
+	status, _, err = s.Reserve(ctx, "k", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, api.IdempotencyInFlight, status)
+
+	require.NoError(t, s.Complete(ctx, "k", []byte(`{"result":1}`), time.Hour))
+	status, resp, err := s.Reserve(ctx, "k", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, api.IdempotencyCompleted, status)
+	assert.JSONEq(t, `{"result":1}`, string(resp))
+
+	now = now.Add(time.Hour)
+	status, _, err = s.Reserve(ctx, "k", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, api.IdempotencyNew, status, "expired entries are reserved again")
+
+	require.NoError(t, s.Release(ctx, "k"))
+	status, _, err = s.Reserve(ctx, "k", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, api.IdempotencyNew, status, "released keys can be retried")
+}
@@ -0,0 +1,95 @@
+// Package ratelimit provides the in-memory RPC rate limiter.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket is an in-memory api.RateLimiter that keeps one token bucket per
+// key. Each bucket holds up to burst tokens and refills at rate tokens per
+// second; a call consumes one token. Limits are per process, so use a shared
+// backend when the host runs several replicas.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[api.RateLimitKey]*bucket
+	lastSweep time.Time
+}
+
+var _ api.RateLimiter = (*TokenBucket)(nil)
+
+// NewTokenBucket returns a TokenBucket refilling rate tokens per second with
+// capacity burst. A burst below 1 is treated as 1.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[api.RateLimitKey]*bucket),
+	}
+}
+
+// Allow consumes a token for key if one is available.
+func (l *TokenBucket) Allow(_ context.Context, key api.RateLimitKey) (api.RateLimitDecision, error) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return api.RateLimitDecision{Allowed: true}, nil
+	}
+	if l.rate <= 0 {
+		return api.RateLimitDecision{Allowed: false}, nil
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return api.RateLimitDecision{Allowed: false, RetryAfter: wait}, nil
+}
+
+func (l *TokenBucket) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+}
+
+// sweep drops buckets that have refilled completely, since a fresh bucket is
+// equivalent. Callers must hold l.mu.
+func (l *TokenBucket) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
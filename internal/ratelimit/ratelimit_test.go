@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	l := NewTokenBucket(2, 2)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+	alice := api.RateLimitKey{UserID: 1, TenantID: "t1", Method: "chat.send"}
+	bob := api.RateLimitKey{UserID: 2, TenantID: "t1", Method: "chat.send"}
+
+	for i := 0; i < 2; i++ {
+		d, err := l.Allow(ctx, alice)
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+	}
+	d, err := l.Allow(ctx, alice)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	d, err = l.Allow(ctx, bob)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed, "buckets are per key")
+
+	now = now.Add(500 * time.Millisecond)
+	d, err = l.Allow(ctx, alice)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed, "one token refilled")
+
+	now = now.Add(2 * sweepInterval)
+	_, err = l.Allow(ctx, alice)
+	require.NoError(t, err)
+	assert.Len(t, l.buckets, 1, "idle full buckets are swept")
+}
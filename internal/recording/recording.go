@@ -0,0 +1,124 @@
+// Package recording provides the JSONL recorder and replayer for applet RPC
+// traffic.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// HashParams returns the hash calls are replayed by. Params are normalized
+// first, so key order and whitespace don't matter and empty params equal null.
+func HashParams(params json.RawMessage) string {
+	normalized := []byte("null")
+	if len(bytes.TrimSpace(params)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err == nil {
+			if data, err := json.Marshal(v); err == nil {
+				normalized = data
+			}
+		} else {
+			normalized = params
+		}
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:])
+}
+
+// JSONLRecorder is an api.RPCRecorder writing one JSON record per line.
+type JSONLRecorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ api.RPCRecorder = (*JSONLRecorder)(nil)
+
+// NewJSONLRecorder returns a recorder appending to w.
+func NewJSONLRecorder(w io.Writer) *JSONLRecorder {
+	return &JSONLRecorder{w: w}
+}
+
+func (r *JSONLRecorder) Record(_ context.Context, rec api.RPCRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("recording: encode record: %w", err)
+	}
+	data = append(data, '\n')
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(data); err != nil {
+		return fmt.Errorf("recording: write record: %w", err)
+	}
+	return nil
+}
+
+type replayKey struct {
+	method     string
+	paramsHash string
+}
+
+// Replayer is an api.RPCReplayer serving records loaded from JSONL. Records
+// of the same call are replayed in recorded order, repeating the last one.
+type Replayer struct {
+	mu      sync.Mutex
+	records map[replayKey][]api.RPCRecord
+	next    map[replayKey]int
+}
+
+var _ api.RPCReplayer = (*Replayer)(nil)
+
+// LoadReplayer reads the records written by a JSONLRecorder. Blank lines are
+// skipped.
+func LoadReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{
+		records: make(map[replayKey][]api.RPCRecord),
+		next:    make(map[replayKey]int),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var rec api.RPCRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("recording: line %d: %w", line, err)
+		}
+		if rec.Method == "" {
+			return nil, fmt.Errorf("recording: line %d: %w: method is empty", line, api.ErrInvalid)
+		}
+		key := replayKey{method: rec.Method, paramsHash: rec.ParamsHash}
+		rp.records[key] = append(rp.records[key], rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("recording: read records: %w", err)
+	}
+	return rp, nil
+}
+
+func (rp *Replayer) Replay(_ context.Context, method, paramsHash string) (api.RPCRecord, bool) {
+	key := replayKey{method: method, paramsHash: paramsHash}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	records := rp.records[key]
+	if len(records) == 0 {
+		return api.RPCRecord{}, false
+	}
+	i := rp.next[key]
+	if i < len(records)-1 {
+		rp.next[key] = i + 1
+	}
+	return records[i], true
+}
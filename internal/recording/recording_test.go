@@ -0,0 +1,54 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashParams(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, HashParams(json.RawMessage(`{"a":1,"b":[1,2]}`)), HashParams(json.RawMessage(` { "b": [1, 2], "a": 1 } `)))
+	assert.Equal(t, HashParams(nil), HashParams(json.RawMessage(`null`)))
+	assert.NotEqual(t, HashParams(json.RawMessage(`{"a":1}`)), HashParams(json.RawMessage(`{"a":2}`)))
+	assert.NotEqual(t, HashParams(json.RawMessage(`{"a":1}`)), HashParams(json.RawMessage(`{"a":"1"}`)))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var buf bytes.Buffer
+	rec := NewJSONLRecorder(&buf)
+	hash := HashParams(json.RawMessage(`{"id":1}`))
+	require.NoError(t, rec.Record(ctx, api.RPCRecord{Method: "items.get", ParamsHash: hash, Result: json.RawMessage(`{"v":1}`)}))
+	require.NoError(t, rec.Record(ctx, api.RPCRecord{Method: "items.get", ParamsHash: hash, Result: json.RawMessage(`{"v":2}`)}))
+	require.NoError(t, rec.Record(ctx, api.RPCRecord{Method: "items.get", ParamsHash: HashParams(nil), Error: &api.RPCRecordError{Code: "validation", Message: "id is required"}}))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+
+	rp, err := LoadReplayer(strings.NewReader(buf.String() + "\n"))
+	require.NoError(t, err)
+
+	for _, want := range []string{`{"v":1}`, `{"v":2}`, `{"v":2}`} {
+		got, ok := rp.Replay(ctx, "items.get", hash)
+		require.True(t, ok)
+		assert.JSONEq(t, want, string(got.Result), "records replay in order and the last one repeats")
+	}
+	got, ok := rp.Replay(ctx, "items.get", HashParams(json.RawMessage(`null`)))
+	require.True(t, ok)
+	require.NotNil(t, got.Error)
+	assert.Equal(t, "validation", got.Error.Code)
+
+	_, ok = rp.Replay(ctx, "items.list", hash)
+	assert.False(t, ok)
+
+	_, err = LoadReplayer(strings.NewReader("{\"method\":\"a\"}\nnot json\n"))
+	require.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Audited params are redacted with `audit` struct tags on procedure params:
+//
+//   - audit:"redact" replaces the field's value with "[REDACTED]".
+//   - audit:"omit" drops the field.
+//
+// Tags apply at any depth, including inside slices and maps.
+
+const auditRedacted = "[REDACTED]"
+
+// checkAuditTags reports malformed `audit` tags on t.
+func checkAuditTags(t reflect.Type) error {
+	return checkAuditTagsDepth(t, make(map[reflect.Type]bool), 0)
+}
+
+func checkAuditTagsDepth(t reflect.Type, seen map[reflect.Type]bool, depth int) error {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] || depth > maxDescribeDepth {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		switch tag := f.Tag.Get("audit"); tag {
+		case "", "redact", "omit":
+		default:
+			return fmt.Errorf("%s.%s: unknown audit tag %q", t.Name(), f.Name, tag)
+		}
+		if err := checkAuditTagsDepth(f.Type, seen, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactForAudit returns v as generic JSON values with `audit` tags applied.
+// Going through JSON keeps the shape clients send, including custom marshalers.
+func redactForAudit(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	return redactGeneric(reflect.TypeOf(v), generic, 0)
+}
+
+func redactGeneric(t reflect.Type, g any, depth int) any {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || depth > maxDescribeDepth {
+		return g
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if items, ok := g.([]any); ok {
+			for i, item := range items {
+				items[i] = redactGeneric(t.Elem(), item, depth+1)
+			}
+		}
+	case reflect.Map:
+		if m, ok := g.(map[string]any); ok {
+			for k, item := range m {
+				m[k] = redactGeneric(t.Elem(), item, depth+1)
+			}
+		}
+	case reflect.Struct:
+		if m, ok := g.(map[string]any); ok {
+			redactStruct(t, m, depth)
+		}
+	default:
+	}
+	return g
+}
+
+func redactStruct(t reflect.Type, m map[string]any, depth int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		// Unlike parseJSONTag, use the key encoding/json writes.
+		jsonName, _, _ := strings.Cut(tag, ",")
+		if jsonName == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && ft.Kind() == reflect.Struct {
+				redactStruct(ft, m, depth+1)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			jsonName = f.Name
+		}
+		value, ok := m[jsonName]
+		if !ok {
+			continue
+		}
+		switch f.Tag.Get("audit") {
+		case "omit":
+			delete(m, jsonName)
+		case "redact":
+			m[jsonName] = auditRedacted
+		default:
+			m[jsonName] = redactGeneric(f.Type, value, depth+1)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// Caller calls the procedures of applets registered in a Registry in process,
+// as the user in the caller's context and with the target as AppletFrom.
+// Permission checks and interceptors apply as for HTTP calls; rate limits and
+// idempotency keys do not.
+type Caller struct {
+	registry api.Registry
+	host     api.HostServices
+}
+
+// NewCaller returns a Caller resolving applets in registry. The user is taken
+// from the request identity in ctx, or through host when there is none.
+func NewCaller(registry api.Registry, host api.HostServices) *Caller {
+	return &Caller{registry: registry, host: host}
+}
+
+// Call calls method of the named applet with params encoded as JSON. Unknown
+// applets and methods fail with api.ErrNotFound, denied calls with
+// api.ErrPermissionDenied; handler errors are returned unchanged.
+func (c *Caller) Call(ctx context.Context, applet, method string, params any) (any, error) {
+	const op = "rpc.Caller.Call"
+	if c == nil || c.registry == nil {
+		return nil, fmt.Errorf("%s: %w: Caller has no registry", op, api.ErrInvalid)
+	}
+	target := c.registry.Get(applet)
+	if target == nil {
+		return nil, fmt.Errorf("%s: %w: applet %q is not registered", op, api.ErrNotFound, applet)
+	}
+	rpcCfg := target.Config().RPC
+	method = strings.TrimSpace(method)
+	var rpcMethod api.RPCMethod
+	ok := false
+	if rpcCfg != nil {
+		rpcMethod, ok = rpcCfg.Methods[method]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: applet %q has no method %q", op, api.ErrNotFound, applet, method)
+	}
+	if rpcMethod.Handler == nil {
+		return nil, fmt.Errorf("%s: %w: %s.%s is a streaming method", op, api.ErrInvalid, applet, method)
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: encode params: %w", op, api.ErrValidation, err)
+	}
+	// The callee runs as the target applet, so handlers scoping by AppletFrom
+	// see their own applet rather than the caller's.
+	ctx = api.WithApplet(ctx, target.Name())
+	if err := api.AuthorizeMethod(ctx, c.user(ctx), rpcMethod, raw); err != nil {
+		return nil, fmt.Errorf("%s: %s.%s: %w", op, applet, method, err)
+	}
+	timeout := rpcMethod.Timeout
+	if timeout <= 0 && rpcCfg != nil {
+		timeout = rpcCfg.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return invokeRecovered(ctx, applet, method, rpcMethod, raw)
+}
+
+// invokeRecovered runs the handler, returning a panic as api.ErrInternal.
+func invokeRecovered(ctx context.Context, applet, method string, rpcMethod api.RPCMethod, params json.RawMessage) (result any, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			result, err = nil, fmt.Errorf("rpc.Caller.Call: %s.%s panicked: %v: %w", applet, method, v, api.ErrInternal)
+		}
+	}()
+	return rpcMethod.Handler(ctx, params)
+}
+
+// user returns the user in ctx, or nil when there is none.
+func (c *Caller) user(ctx context.Context) api.AppletUser {
+	if u, ok := api.UserFrom(ctx); ok {
+		return u
+	}
+	if c.host == nil {
+		return nil
+	}
+	u, _ := c.host.ExtractUser(ctx)
+	return u
+}
+
+// CallApplet is Caller.Call with a typed result. A result of another type,
+// such as the target applet's own struct, is converted through JSON.
+func CallApplet[P any, R any](ctx context.Context, c *Caller, applet, method string, params P) (R, error) {
+	var zero R
+	res, err := c.Call(ctx, applet, method, params)
+	if err != nil {
+		return zero, err
+	}
+	if typed, ok := res.(R); ok {
+		return typed, nil
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return zero, fmt.Errorf("rpc.CallApplet: %w: encode %s.%s result: %w", api.ErrInternal, applet, method, err)
+	}
+	var out R
+	if err := json.Unmarshal(data, &out); err != nil {
+		return zero, fmt.Errorf("rpc.CallApplet: %w: decode %s.%s result: %w", api.ErrInternal, applet, method, err)
+	}
+	return out, nil
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/iota-uz/applets/internal/api"
 )
@@ -22,15 +23,83 @@ func DescribeTypedRPCRouter(r *TypedRPCRouter) (*api.TypedRouterDescription, err
 	for _, p := range r.procs {
 		params := describeType(p.paramType, defs, seen, 0)
 		result := describeType(p.resultType, defs, seen, 0)
-		methods = append(methods, api.TypedMethodDescription{
+		m := api.TypedMethodDescription{
 			Name:               p.name,
 			RequirePermissions: append([]string(nil), p.requirePermissions...),
 			Params:             params,
 			Result:             result,
-		})
+			Stream:             p.stream,
+			Idempotent:         p.idempotent,
+			Query:              p.query,
+			Errors:             append([]string(nil), p.errors...),
+		}
+		if p.upload {
+			m.Upload = &api.TypedUploadDescription{
+				MaxFileBytes: p.maxFileBytes,
+				AllowedTypes: append([]string(nil), p.allowedTypes...),
+			}
+		}
+		if expr := r.permissionsFor(p); expr != nil {
+			perms := expr.Describe()
+			m.Permissions = &perms
+		}
+		if _, version, ok := strings.Cut(p.name, "@"); ok {
+			m.Version = version
+		}
+		if d := p.deprecated; d != nil {
+			m.Deprecated = true
+			m.DeprecationMessage = d.Message
+			if !d.Sunset.IsZero() {
+				m.Sunset = d.Sunset.UTC().Format(time.DateOnly)
+			}
+		}
+		methods = append(methods, m)
 	}
 	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
-	return &api.TypedRouterDescription{Methods: methods, Types: defs}, nil
+	return &api.TypedRouterDescription{
+		Methods:   methods,
+		Types:     defs,
+		Encodings: describeEncodings(r),
+		Errors:    describeErrors(r, defs, seen),
+	}, nil
+}
+
+// describeErrors lists the router's registered error codes sorted by code.
+func describeErrors(r *TypedRPCRouter, defs map[string]api.TypedTypeObject, seen map[reflect.Type]bool) []api.TypedErrorDescription {
+	if len(r.errors) == 0 {
+		return nil
+	}
+	out := make([]api.TypedErrorDescription, 0, len(r.errors))
+	for _, spec := range r.errors {
+		e := api.TypedErrorDescription{Code: spec.code, Message: spec.message}
+		if spec.detailsType != nil {
+			details := describeType(spec.detailsType, defs, seen, 0)
+			e.Details = &details
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// describeEncodings lists the router's encodings, or nil when it only uses the
+// built-in JSON and gzip.
+func describeEncodings(r *TypedRPCRouter) *api.TypedEncodings {
+	if len(r.codecs) == 0 && len(r.compressors) == 0 {
+		return nil
+	}
+	enc := &api.TypedEncodings{
+		ContentTypes:     []string{"application/json"},
+		ContentEncodings: make([]string, 0, len(r.compressors)+1),
+	}
+	for _, codec := range r.codecs {
+		enc.ContentTypes = append(enc.ContentTypes, codec.ContentType())
+	}
+	for _, comp := range r.compressors {
+		enc.ContentEncodings = append(enc.ContentEncodings, comp.Encoding())
+	}
+	enc.ContentEncodings = append(enc.ContentEncodings, "gzip")
+	return enc
 }
 
 func describeType(t reflect.Type, defs map[string]api.TypedTypeObject, seen map[reflect.Type]bool, depth int) api.TypeRef {
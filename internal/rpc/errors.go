@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+var errorCodeRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// builtinErrorCodes are the codes the RPC endpoint produces itself. Procedures
+// may declare them without registering.
+var builtinErrorCodes = []string{
+	"validation", "invalid", "not_found", "forbidden", "internal",
+	"rate_limited", "conflict", "payload_too_large", "timeout", "canceled",
+}
+
+type errorSpec struct {
+	code        string
+	message     string
+	detailsType reflect.Type
+}
+
+// RegisterErrorCode registers a domain error code with details of type D on
+// the router. Handlers return errors created with the returned ErrorCode, and
+// procedures list the code in Errors so generated clients can type it.
+func RegisterErrorCode[D any](r *TypedRPCRouter, code, message string) (api.ErrorCode[D], error) {
+	const op = "rpc.RegisterErrorCode"
+	if r == nil {
+		return api.ErrorCode[D]{}, fmt.Errorf("%s: %w: TypedRPCRouter is nil", op, api.ErrInvalid)
+	}
+	code = strings.TrimSpace(code)
+	if !errorCodeRe.MatchString(code) {
+		return api.ErrorCode[D]{}, fmt.Errorf("%s: %w: error code %q must be snake_case", op, api.ErrInvalid, code)
+	}
+	if slices.Contains(builtinErrorCodes, code) {
+		return api.ErrorCode[D]{}, fmt.Errorf("%s: %w: error code %q is built in", op, api.ErrInvalid, code)
+	}
+	if r.findErrorCode(code) != nil {
+		return api.ErrorCode[D]{}, fmt.Errorf("%s: %w: error code %q is already registered", op, api.ErrInvalid, code)
+	}
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return api.ErrorCode[D]{}, fmt.Errorf("%s: %w: error code %q has no message", op, api.ErrInvalid, code)
+	}
+	spec := &errorSpec{code: code, message: message}
+	if t := reflect.TypeOf((*D)(nil)).Elem(); t != reflect.TypeOf(struct{}{}) {
+		spec.detailsType = t
+	}
+	r.errors = append(r.errors, spec)
+	return api.ErrorCode[D]{Code: code, Message: message}, nil
+}
+
+func (r *TypedRPCRouter) findErrorCode(code string) *errorSpec {
+	for _, spec := range r.errors {
+		if spec.code == code {
+			return spec
+		}
+	}
+	return nil
+}
+
+// checkErrorCodes returns the declared codes without blanks or duplicates, or
+// an error if one is neither built in nor registered.
+func (r *TypedRPCRouter) checkErrorCodes(codes []string) ([]string, error) {
+	var out []string
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if code == "" || slices.Contains(out, code) {
+			continue
+		}
+		if !slices.Contains(builtinErrorCodes, code) && r.findErrorCode(code) == nil {
+			return nil, fmt.Errorf("unknown error code %q; register it with RegisterErrorCode first", code)
+		}
+		out = append(out, code)
+	}
+	return out, nil
+}
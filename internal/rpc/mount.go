@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// Mount adds the procedures of sub under prefix, so "send" on sub becomes
+// "chat.send" for Mount("chat", sub). Mounted procedures run the parent's
+// interceptors and permissions outside of sub's, and sub's error codes are
+// added to the parent. Mount copies sub's procedures: register them before
+// mounting. Codecs and compressors of sub are ignored.
+func (r *TypedRPCRouter) Mount(prefix string, sub *TypedRPCRouter) error {
+	const op = "rpc.TypedRPCRouter.Mount"
+	if r == nil || sub == nil {
+		return fmt.Errorf("%s: %w: TypedRPCRouter is nil", op, api.ErrInvalid)
+	}
+	if r == sub {
+		return fmt.Errorf("%s: %w: cannot mount a router into itself", op, api.ErrInvalid)
+	}
+	prefix = strings.TrimSpace(prefix)
+	if !validMountPrefix(prefix) {
+		return fmt.Errorf("%s: %w: prefix %q must be dot-separated names without spaces or '@'", op, api.ErrInvalid, prefix)
+	}
+
+	for _, p := range sub.procs {
+		if name := prefix + "." + p.name; r.findProcedure(name) != nil {
+			return fmt.Errorf("%s: %w: procedure %q is already registered", op, api.ErrInvalid, name)
+		}
+	}
+	for _, spec := range sub.errors {
+		if existing := r.findErrorCode(spec.code); existing != nil && (existing.message != spec.message || existing.detailsType != spec.detailsType) {
+			return fmt.Errorf("%s: %w: error code %q is registered differently on both routers", op, api.ErrInvalid, spec.code)
+		}
+	}
+
+	for _, spec := range sub.errors {
+		if r.findErrorCode(spec.code) == nil {
+			r.errors = append(r.errors, spec)
+		}
+	}
+	for _, p := range sub.procs {
+		mounted := *p
+		mounted.name = prefix + "." + p.name
+		mounted.mountInterceptors = append(append([]api.RPCInterceptor(nil), sub.interceptors...), p.mountInterceptors...)
+		mounted.mountPermissions = append(append([]api.PermissionExpr(nil), sub.permissions...), p.mountPermissions...)
+		r.procs = append(r.procs, &mounted)
+	}
+	return nil
+}
+
+func validMountPrefix(prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	for _, segment := range strings.Split(prefix, ".") {
+		if segment == "" || strings.ContainsFunc(segment, func(c rune) bool { return c == '@' || unicode.IsSpace(c) }) {
+			return false
+		}
+	}
+	return true
+}
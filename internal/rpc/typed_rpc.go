@@ -7,22 +7,58 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/iota-uz/applets/internal/api"
 )
 
-type typedProcedure struct {
-	name               string
+// versionedNameRe matches procedure names with a version suffix, e.g. "chat.send@v2".
+var versionedNameRe = regexp.MustCompile(`^[^@\s]+@v[1-9][0-9]*$`)
+
+// procedureSpec holds the untyped settings shared by Procedure and StreamProcedure.
+type procedureSpec struct {
 	requirePermissions []string
-	paramType          reflect.Type
-	resultType         reflect.Type
-	method             api.RPCMethod
+	permissions        api.PermissionExpr
+	interceptors       []api.RPCInterceptor
+	rateLimiter        api.RateLimiter
+	idempotent         bool
+	timeout            time.Duration
+	query              bool
+	cacheControl       string
+	deprecated         *api.Deprecation
+	audit              bool
+	errors             []string
+	maxBodyBytes       int64
+	maxFileBytes       int64
+	allowedTypes       []string
+}
+
+type typedProcedure struct {
+	procedureSpec
+	name       string
+	paramType  reflect.Type
+	resultType reflect.Type
+	stream     bool
+	upload     bool
+	decode     func(params json.RawMessage) (any, error)
+	invoke     api.RPCNext
+	// mountInterceptors and mountPermissions come from the sub-routers the
+	// procedure was mounted from, outermost first.
+	mountInterceptors []api.RPCInterceptor
+	mountPermissions  []api.PermissionExpr
+	invokeStream      func(ctx context.Context, params any, emit func(event any) error) error
 }
 
 // TypedRPCRouter holds typed RPC procedures and can produce RPCConfig.
 type TypedRPCRouter struct {
-	procs []*typedProcedure
+	procs        []*typedProcedure
+	interceptors []api.RPCInterceptor
+	codecs       []api.RPCCodec
+	compressors  []api.RPCCompressor
+	errors       []*errorSpec
+	permissions  []api.PermissionExpr
 }
 
 // NewTypedRPCRouter returns a new TypedRPCRouter.
@@ -30,24 +66,209 @@ func NewTypedRPCRouter() *TypedRPCRouter {
 	return &TypedRPCRouter{procs: make([]*typedProcedure, 0)}
 }
 
+// Use appends router-level interceptors. They wrap every procedure in
+// registration order, outside of per-procedure interceptors, and must be
+// added before Config is called.
+func (r *TypedRPCRouter) Use(interceptors ...api.RPCInterceptor) {
+	for _, ic := range interceptors {
+		if ic != nil {
+			r.interceptors = append(r.interceptors, ic)
+		}
+	}
+}
+
+// UsePermissions requires exprs for every procedure of the router, including
+// procedures of mounted sub-routers, on top of each procedure's own checks.
+func (r *TypedRPCRouter) UsePermissions(exprs ...api.PermissionExpr) {
+	for _, expr := range exprs {
+		if expr != nil {
+			r.permissions = append(r.permissions, expr)
+		}
+	}
+}
+
+// UseCodecs adds payload codecs on top of the built-in JSON codec.
+func (r *TypedRPCRouter) UseCodecs(codecs ...api.RPCCodec) {
+	for _, codec := range codecs {
+		if codec != nil {
+			r.codecs = append(r.codecs, codec)
+		}
+	}
+}
+
+// UseCompressors adds response compressors on top of the built-in gzip.
+func (r *TypedRPCRouter) UseCompressors(compressors ...api.RPCCompressor) {
+	for _, comp := range compressors {
+		if comp != nil {
+			r.compressors = append(r.compressors, comp)
+		}
+	}
+}
+
 // AddProcedure registers a typed procedure.
 func AddProcedure[P any, R any](r *TypedRPCRouter, name string, p api.Procedure[P, R]) error {
 	const op = "rpc.AddProcedure"
+	if p.Handler == nil {
+		return fmt.Errorf("%s: %w: procedure handler is nil", op, api.ErrInvalid)
+	}
+	proc, typedParams, err := newTypedProcedure[P](op, r, name, procedureSpec{
+		requirePermissions: p.RequirePermissions,
+		permissions:        p.Permissions,
+		interceptors:       p.Interceptors,
+		rateLimiter:        p.RateLimiter,
+		idempotent:         p.Idempotent,
+		timeout:            p.Timeout,
+		query:              p.Query,
+		cacheControl:       strings.TrimSpace(p.CacheControl),
+		deprecated:         p.Deprecated,
+		audit:              p.Audit,
+		errors:             p.Errors,
+		maxBodyBytes:       p.MaxBodyBytes,
+	})
+	if err != nil {
+		return err
+	}
+	proc.resultType = reflect.TypeOf((*R)(nil)).Elem()
+	proc.invoke = func(ctx context.Context, params any) (any, error) {
+		typed, err := typedParams(params)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Handler(ctx, typed)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	r.procs = append(r.procs, proc)
+	return nil
+}
+
+// AddStreamProcedure registers a typed streaming procedure whose handler emits events of type E.
+func AddStreamProcedure[P any, E any](r *TypedRPCRouter, name string, p api.StreamProcedure[P, E]) error {
+	const op = "rpc.AddStreamProcedure"
+	if p.Handler == nil {
+		return fmt.Errorf("%s: %w: procedure handler is nil", op, api.ErrInvalid)
+	}
+	proc, typedParams, err := newTypedProcedure[P](op, r, name, procedureSpec{
+		requirePermissions: p.RequirePermissions,
+		permissions:        p.Permissions,
+		interceptors:       p.Interceptors,
+		rateLimiter:        p.RateLimiter,
+		deprecated:         p.Deprecated,
+		errors:             p.Errors,
+		maxBodyBytes:       p.MaxBodyBytes,
+	})
+	if err != nil {
+		return err
+	}
+	proc.resultType = reflect.TypeOf((*E)(nil)).Elem()
+	proc.stream = true
+	proc.invokeStream = func(ctx context.Context, params any, emit func(event any) error) error {
+		typed, err := typedParams(params)
+		if err != nil {
+			return err
+		}
+		return p.Handler(ctx, typed, func(event E) error { return emit(event) })
+	}
+	r.procs = append(r.procs, proc)
+	return nil
+}
+
+// AddUploadProcedure registers a typed procedure that receives files; see
+// api.UploadProcedure for the request format.
+func AddUploadProcedure[P any, R any](r *TypedRPCRouter, name string, p api.UploadProcedure[P, R]) error {
+	const op = "rpc.AddUploadProcedure"
+	if p.Handler == nil {
+		return fmt.Errorf("%s: %w: procedure handler is nil", op, api.ErrInvalid)
+	}
+	allowedTypes := make([]string, 0, len(p.AllowedTypes))
+	for _, t := range p.AllowedTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if _, _, ok := strings.Cut(t, "/"); !ok {
+			return fmt.Errorf("%s: %w: procedure %q: allowed type %q is not a media type", op, api.ErrInvalid, name, t)
+		}
+		allowedTypes = append(allowedTypes, t)
+	}
+	proc, typedParams, err := newTypedProcedure[P](op, r, name, procedureSpec{
+		requirePermissions: p.RequirePermissions,
+		permissions:        p.Permissions,
+		interceptors:       p.Interceptors,
+		rateLimiter:        p.RateLimiter,
+		timeout:            p.Timeout,
+		deprecated:         p.Deprecated,
+		audit:              p.Audit,
+		errors:             p.Errors,
+		maxBodyBytes:       p.MaxBodyBytes,
+		maxFileBytes:       p.MaxFileBytes,
+		allowedTypes:       allowedTypes,
+	})
+	if err != nil {
+		return err
+	}
+	proc.resultType = reflect.TypeOf((*R)(nil)).Elem()
+	proc.upload = true
+	proc.invoke = func(ctx context.Context, params any) (any, error) {
+		files, ok := api.UploadFilesFrom(ctx)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: procedure %q must be called with a multipart/form-data body", op, api.ErrInvalid, name)
+		}
+		typed, err := typedParams(params)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Handler(ctx, typed, files)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	r.procs = append(r.procs, proc)
+	return nil
+}
+
+// newTypedProcedure validates the registration and returns a procedure with
+// params decoding set up, plus a func that asserts and validates params of
+// type P right before the handler runs.
+func newTypedProcedure[P any](op string, r *TypedRPCRouter, name string, spec procedureSpec) (*typedProcedure, func(params any) (P, error), error) {
 	if r == nil {
-		return fmt.Errorf("%s: %w: TypedRPCRouter is nil", op, api.ErrInvalid)
+		return nil, nil, fmt.Errorf("%s: %w: TypedRPCRouter is nil", op, api.ErrInvalid)
 	}
 	name = strings.TrimSpace(name)
 	if name == "" {
-		return fmt.Errorf("%s: %w: procedure name is empty", op, api.ErrInvalid)
+		return nil, nil, fmt.Errorf("%s: %w: procedure name is empty", op, api.ErrInvalid)
 	}
-	if p.Handler == nil {
-		return fmt.Errorf("%s: %w: procedure handler is nil", op, api.ErrInvalid)
+	if strings.Contains(name, "@") && !versionedNameRe.MatchString(name) {
+		return nil, nil, fmt.Errorf("%s: %w: procedure %q: versioned names must look like name@v2", op, api.ErrInvalid, name)
+	}
+	if r.findProcedure(name) != nil {
+		return nil, nil, fmt.Errorf("%s: %w: procedure %q is already registered", op, api.ErrInvalid, name)
 	}
 	paramType := reflect.TypeOf((*P)(nil)).Elem()
-	resultType := reflect.TypeOf((*R)(nil)).Elem()
-	method := api.RPCMethod{
-		RequirePermissions: p.RequirePermissions,
-		Handler: func(ctx context.Context, params json.RawMessage) (any, error) {
+	hasValidation, err := checkValidationTags(paramType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w: procedure %q: invalid validate tag: %w", op, api.ErrInvalid, name, err)
+	}
+	if spec.errors, err = r.checkErrorCodes(spec.errors); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w: procedure %q: %w", op, api.ErrInvalid, name, err)
+	}
+	if spec.audit {
+		if err := checkAuditTags(paramType); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w: procedure %q: invalid audit tag: %w", op, api.ErrInvalid, name, err)
+		}
+	}
+	interceptors := spec.interceptors
+	spec.interceptors = nil
+	for _, ic := range interceptors {
+		if ic != nil {
+			spec.interceptors = append(spec.interceptors, ic)
+		}
+	}
+	proc := &typedProcedure{
+		procedureSpec: spec,
+		name:          name,
+		paramType:     paramType,
+		decode: func(params json.RawMessage) (any, error) {
 			var decoded P
 			trimmed := bytes.TrimSpace(params)
 			if len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
@@ -60,31 +281,139 @@ func AddProcedure[P any, R any](r *TypedRPCRouter, name string, p api.Procedure[
 					return nil, fmt.Errorf("%s: %w: invalid params: %w", op, api.ErrInvalid, err)
 				}
 			}
-			res, err := p.Handler(ctx, decoded)
-			if err != nil {
-				return nil, err
-			}
-			return res, nil
+			return decoded, nil
 		},
 	}
-	r.procs = append(r.procs, &typedProcedure{
-		name:               name,
-		requirePermissions: p.RequirePermissions,
-		paramType:          paramType,
-		resultType:         resultType,
-		method:             method,
-	})
+	typedParams := func(params any) (P, error) {
+		typed, ok := params.(P)
+		if !ok && params != nil {
+			return typed, fmt.Errorf("%s: %w: interceptor passed params of type %T, want %s", op, api.ErrInternal, params, paramType)
+		}
+		if hasValidation {
+			if err := validateParams(typed); err != nil {
+				return typed, err
+			}
+		}
+		return typed, nil
+	}
+	return proc, typedParams, nil
+}
+
+func (r *TypedRPCRouter) findProcedure(name string) *typedProcedure {
+	for _, p := range r.procs {
+		if p.name == name {
+			return p
+		}
+	}
 	return nil
 }
 
+// permissionsFor returns the permission expression p is checked against:
+// the router's, then the mounted sub-routers', then its own.
+func (r *TypedRPCRouter) permissionsFor(p *typedProcedure) api.PermissionExpr {
+	exprs := make([]api.PermissionExpr, 0, len(r.permissions)+len(p.mountPermissions)+1)
+	exprs = append(exprs, r.permissions...)
+	exprs = append(exprs, p.mountPermissions...)
+	if p.permissions != nil {
+		exprs = append(exprs, p.permissions)
+	}
+	switch len(exprs) {
+	case 0:
+		return nil
+	case 1:
+		return exprs[0]
+	default:
+		return api.AllOf(exprs...)
+	}
+}
+
 // Config returns the RPC config for this router.
 func (r *TypedRPCRouter) Config() *api.RPCConfig {
 	methods := make(map[string]api.RPCMethod, len(r.procs))
 	for _, p := range r.procs {
-		methods[p.name] = p.method
+		methods[p.name] = r.rpcMethod(p)
+	}
+	errorCodes := make([]string, 0, len(r.errors))
+	for _, spec := range r.errors {
+		errorCodes = append(errorCodes, spec.code)
 	}
 	return &api.RPCConfig{
-		Path:    "/rpc",
-		Methods: methods,
+		Path:        "/rpc",
+		Codecs:      append([]api.RPCCodec(nil), r.codecs...),
+		Compressors: append([]api.RPCCompressor(nil), r.compressors...),
+		Describe:    func() (*api.TypedRouterDescription, error) { return DescribeTypedRPCRouter(r) },
+		ErrorCodes:  errorCodes,
+		Methods:     methods,
+	}
+}
+
+// rpcMethod builds the untyped method for p: decode params, then run the
+// interceptor chain around the typed handler.
+func (r *TypedRPCRouter) rpcMethod(p *typedProcedure) api.RPCMethod {
+	chain := make([]api.RPCInterceptor, 0, len(r.interceptors)+len(p.mountInterceptors)+len(p.interceptors))
+	chain = append(chain, r.interceptors...)
+	chain = append(chain, p.mountInterceptors...)
+	chain = append(chain, p.interceptors...)
+	method := api.RPCMethod{
+		RequirePermissions: p.requirePermissions,
+		Permissions:        r.permissionsFor(p),
+		RateLimiter:        p.rateLimiter,
+		Idempotent:         p.idempotent,
+		Timeout:            p.timeout,
+		Query:              p.query,
+		CacheControl:       p.cacheControl,
+		Deprecated:         p.deprecated,
+		Audit:              p.audit,
+		MaxBodyBytes:       p.maxBodyBytes,
+		Upload:             p.upload,
+		MaxFileBytes:       p.maxFileBytes,
+		AllowedTypes:       p.allowedTypes,
+	}
+	method.RedactParams = func(params json.RawMessage) any {
+		decoded, err := p.decode(params)
+		if err != nil {
+			return nil
+		}
+		return redactForAudit(decoded)
+	}
+	method.RedactResult = redactForAudit
+	if p.audit {
+		method.AuditParams = method.RedactParams
+	}
+	if p.stream {
+		method.Stream = func(ctx context.Context, params json.RawMessage, emit func(event any) error) error {
+			decoded, err := p.decode(params)
+			if err != nil {
+				return err
+			}
+			next := chainInterceptors(p.name, chain, func(ctx context.Context, params any) (any, error) {
+				return nil, p.invokeStream(ctx, params, emit)
+			})
+			_, err = next(ctx, decoded)
+			return err
+		}
+		return method
+	}
+	next := chainInterceptors(p.name, chain, p.invoke)
+	method.Handler = func(ctx context.Context, params json.RawMessage) (any, error) {
+		decoded, err := p.decode(params)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, decoded)
+	}
+	return method
+}
+
+func chainInterceptors(method string, chain []api.RPCInterceptor, next api.RPCNext) api.RPCNext {
+	for i := len(chain) - 1; i >= 0; i-- {
+		next = intercept(method, chain[i], next)
+	}
+	return next
+}
+
+func intercept(method string, ic api.RPCInterceptor, next api.RPCNext) api.RPCNext {
+	return func(ctx context.Context, params any) (any, error) {
+		return ic(ctx, method, params, next)
 	}
 }
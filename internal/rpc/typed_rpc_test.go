@@ -0,0 +1,663 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iota-uz/applets/internal/api"
+	"github.com/iota-uz/applets/internal/registry"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+type echoParams struct {
+	Msg string `json:"msg"`
+}
+
+type echoResult struct {
+	Msg string `json:"msg"`
+}
+
+func echoHandler(_ context.Context, p echoParams) (echoResult, error) {
+	return echoResult(p), nil
+}
+
+func TestTypedRPCRouter_Interceptors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("RouterThenProcedureOrder", func(t *testing.T) {
+		t.Parallel()
+
+		var calls []string
+		record := func(label string) api.RPCInterceptor {
+			return func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+				calls = append(calls, label+":"+method+":"+params.(echoParams).Msg)
+				return next(ctx, params)
+			}
+		}
+		r := NewTypedRPCRouter()
+		r.Use(record("router1"), record("router2"))
+		require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{
+			Interceptors: []api.RPCInterceptor{record("proc")},
+			Handler:      echoHandler,
+		}))
+
+		res, err := r.Config().Methods["demo.echo"].Handler(context.Background(), json.RawMessage(`{"msg":"hi"}`))
+		require.NoError(t, err)
+		assert.Equal(t, echoResult{Msg: "hi"}, res)
+		assert.Equal(t, []string{"router1:demo.echo:hi", "router2:demo.echo:hi", "proc:demo.echo:hi"}, calls)
+	})
+
+	t.Run("ReplacesParams", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewTypedRPCRouter()
+		r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+			p := params.(echoParams)
+			p.Msg = "normalized"
+			return next(ctx, p)
+		})
+		require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+
+		res, err := r.Config().Methods["demo.echo"].Handler(context.Background(), json.RawMessage(`{"msg":"raw"}`))
+		require.NoError(t, err)
+		assert.Equal(t, echoResult{Msg: "normalized"}, res)
+	})
+
+	t.Run("ShortCircuits", func(t *testing.T) {
+		t.Parallel()
+
+		denied := errors.New("denied")
+		r := NewTypedRPCRouter()
+		r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+			return nil, denied
+		})
+		require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{
+			Handler: func(context.Context, echoParams) (echoResult, error) {
+				t.Fatal("handler must not run")
+				return echoResult{}, nil
+			},
+		}))
+
+		_, err := r.Config().Methods["demo.echo"].Handler(context.Background(), nil)
+		require.ErrorIs(t, err, denied)
+	})
+
+	t.Run("WrongParamsTypeIsInternal", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewTypedRPCRouter()
+		r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+			return next(ctx, "not echo params")
+		})
+		require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+
+		_, err := r.Config().Methods["demo.echo"].Handler(context.Background(), nil)
+		require.ErrorIs(t, err, api.ErrInternal)
+	})
+
+	t.Run("InvalidParamsSkipChain", func(t *testing.T) {
+		t.Parallel()
+
+		r := NewTypedRPCRouter()
+		r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+			t.Fatal("interceptor must not run for undecodable params")
+			return nil, nil
+		})
+		require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+
+		_, err := r.Config().Methods["demo.echo"].Handler(context.Background(), json.RawMessage(`{"unknown":1}`))
+		require.ErrorIs(t, err, api.ErrInvalid)
+	})
+}
+
+type createItemParams struct {
+	Name  string      `json:"name" validate:"required,max=5"`
+	Sort  string      `json:"sort,omitempty" validate:"oneof=asc desc"`
+	Count int         `json:"count" validate:"min=1,max=10"`
+	Tags  []string    `json:"tags" validate:"min=1"`
+	Note  *string     `json:"note,omitempty" validate:"min=2"`
+	Items []itemInput `json:"items"`
+}
+
+type itemInput struct {
+	Label string `json:"label" validate:"required"`
+}
+
+func TestAddProcedure_Validation(t *testing.T) {
+	t.Parallel()
+
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "items.create", api.Procedure[createItemParams, echoResult]{
+		Handler: func(context.Context, createItemParams) (echoResult, error) { return echoResult{Msg: "ok"}, nil },
+	}))
+	handler := r.Config().Methods["items.create"].Handler
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := handler(context.Background(), json.RawMessage(`{"name":"ab","sort":"asc","count":3,"tags":["x"],"items":[{"label":"a"}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, echoResult{Msg: "ok"}, res)
+	})
+
+	t.Run("FieldErrors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := handler(context.Background(), json.RawMessage(`{"name":"toolong","sort":"up","count":0,"tags":[],"note":"x","items":[{"label":""}]}`))
+		require.ErrorIs(t, err, api.ErrValidation)
+		var verr *api.ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Equal(t, []api.FieldError{
+			{Field: "name", Rule: "max", Message: "must contain at most 5 characters"},
+			{Field: "sort", Rule: "oneof", Message: "must be one of: asc, desc"},
+			{Field: "count", Rule: "min", Message: "must be at least 1"},
+			{Field: "tags", Rule: "min", Message: "must contain at least 1 items"},
+			{Field: "note", Rule: "min", Message: "must contain at least 2 characters"},
+			{Field: "items[0].label", Rule: "required", Message: "is required"},
+		}, verr.Fields)
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := handler(context.Background(), json.RawMessage(`{"sort":"asc","count":1,"tags":["x"]}`))
+		var verr *api.ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Equal(t, []api.FieldError{{Field: "name", Rule: "required", Message: "is required"}}, verr.Fields)
+	})
+}
+
+func TestAddProcedure_InvalidValidateTag(t *testing.T) {
+	t.Parallel()
+
+	type badParams struct {
+		Name string `json:"name" validate:"requird"`
+	}
+	r := NewTypedRPCRouter()
+	err := AddProcedure(r, "bad", api.Procedure[badParams, echoResult]{
+		Handler: func(context.Context, badParams) (echoResult, error) { return echoResult{}, nil },
+	})
+	require.ErrorIs(t, err, api.ErrInvalid)
+	assert.Contains(t, err.Error(), `unknown rule "requird"`)
+}
+
+func TestAddStreamProcedure(t *testing.T) {
+	t.Parallel()
+
+	var seen []string
+	r := NewTypedRPCRouter()
+	r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+		seen = append(seen, method)
+		return next(ctx, params)
+	})
+	require.NoError(t, AddStreamProcedure(r, "demo.count", api.StreamProcedure[echoParams, echoResult]{
+		Handler: func(ctx context.Context, p echoParams, emit api.StreamEmitter[echoResult]) error {
+			for _, s := range []string{p.Msg, p.Msg + p.Msg} {
+				if err := emit(echoResult{Msg: s}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}))
+
+	m := r.Config().Methods["demo.count"]
+	require.Nil(t, m.Handler)
+	require.NotNil(t, m.Stream)
+
+	var events []any
+	err := m.Stream(context.Background(), json.RawMessage(`{"msg":"a"}`), func(event any) error {
+		events = append(events, event)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []any{echoResult{Msg: "a"}, echoResult{Msg: "aa"}}, events)
+	assert.Equal(t, []string{"demo.count"}, seen)
+
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	require.Len(t, desc.Methods, 1)
+	assert.True(t, desc.Methods[0].Stream)
+	assert.Equal(t, "named", desc.Methods[0].Result.Kind)
+}
+
+type stubFiles struct {
+	files []*api.UploadFile
+}
+
+func (s *stubFiles) Next() (*api.UploadFile, error) {
+	if len(s.files) == 0 {
+		return nil, io.EOF
+	}
+	f := s.files[0]
+	s.files = s.files[1:]
+	return f, nil
+}
+
+func TestAddUploadProcedure(t *testing.T) {
+	t.Parallel()
+
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{MaxBodyBytes: 4 << 20, Handler: echoHandler}))
+	require.NoError(t, AddUploadProcedure(r, "demo.import", api.UploadProcedure[echoParams, echoResult]{
+		MaxBodyBytes: 8 << 20,
+		MaxFileBytes: 1 << 20,
+		AllowedTypes: []string{" Text/CSV ", "image/*"},
+		Handler: func(ctx context.Context, p echoParams, files api.UploadFiles) (echoResult, error) {
+			msg := p.Msg
+			for {
+				f, err := files.Next()
+				if err == io.EOF {
+					return echoResult{Msg: msg}, nil
+				}
+				if err != nil {
+					return echoResult{}, err
+				}
+				data, err := io.ReadAll(f.Body)
+				if err != nil {
+					return echoResult{}, err
+				}
+				msg += ":" + f.Filename + "=" + string(data)
+			}
+		},
+	}))
+	err := AddUploadProcedure(r, "demo.bad", api.UploadProcedure[echoParams, echoResult]{
+		AllowedTypes: []string{"csv"},
+		Handler: func(ctx context.Context, p echoParams, files api.UploadFiles) (echoResult, error) {
+			return echoResult{}, nil
+		},
+	})
+	require.ErrorIs(t, err, api.ErrInvalid)
+
+	cfg := r.Config()
+	assert.Equal(t, int64(4<<20), cfg.Methods["demo.echo"].MaxBodyBytes)
+	m := cfg.Methods["demo.import"]
+	assert.True(t, m.Upload)
+	assert.Equal(t, int64(8<<20), m.MaxBodyBytes)
+	assert.Equal(t, int64(1<<20), m.MaxFileBytes)
+	assert.Equal(t, []string{"text/csv", "image/*"}, m.AllowedTypes)
+
+	_, err = m.Handler(context.Background(), json.RawMessage(`{"msg":"a"}`))
+	require.ErrorIs(t, err, api.ErrInvalid, "upload procedures need files")
+
+	files := &stubFiles{files: []*api.UploadFile{{Filename: "a.csv", Body: strings.NewReader("1,2")}}}
+	res, err := m.Handler(api.WithUploadFiles(context.Background(), files), json.RawMessage(`{"msg":"a"}`))
+	require.NoError(t, err)
+	assert.Equal(t, echoResult{Msg: "a:a.csv=1,2"}, res)
+
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	require.Len(t, desc.Methods, 2)
+	assert.Nil(t, desc.Methods[0].Upload)
+	assert.Equal(t, &api.TypedUploadDescription{MaxFileBytes: 1 << 20, AllowedTypes: []string{"text/csv", "image/*"}}, desc.Methods[1].Upload)
+}
+
+type stubCodec struct{}
+
+func (stubCodec) ContentType() string         { return "application/msgpack" }
+func (stubCodec) Marshal(any) ([]byte, error) { return nil, nil }
+func (stubCodec) Unmarshal([]byte, any) error { return nil }
+
+func TestDescribeTypedRPCRouter_Encodings(t *testing.T) {
+	t.Parallel()
+
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "demo.echo", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	assert.Nil(t, desc.Encodings, "built-in encodings are not described")
+
+	r.UseCodecs(stubCodec{})
+	desc, err = DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	assert.Equal(t, &api.TypedEncodings{
+		ContentTypes:     []string{"application/json", "application/msgpack"},
+		ContentEncodings: []string{"gzip"},
+	}, desc.Encodings)
+	assert.Len(t, r.Config().Codecs, 1)
+}
+
+func TestAddProcedure_Versions(t *testing.T) {
+	t.Parallel()
+
+	sunset := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "chat.send", api.Procedure[echoParams, echoResult]{
+		Deprecated: &api.Deprecation{Message: "Use chat.send@v2.", Sunset: sunset},
+		Handler:    echoHandler,
+	}))
+	require.NoError(t, AddProcedure(r, "chat.send@v2", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+
+	err := AddProcedure(r, "chat.send@v2", api.Procedure[echoParams, echoResult]{Handler: echoHandler})
+	require.ErrorIs(t, err, api.ErrInvalid, "duplicate names are rejected")
+	for _, bad := range []string{"chat.send@2", "chat.send@v0", "@v2", "chat@v2@v3"} {
+		err := AddProcedure(r, bad, api.Procedure[echoParams, echoResult]{Handler: echoHandler})
+		require.ErrorIs(t, err, api.ErrInvalid, bad)
+	}
+
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	require.Len(t, desc.Methods, 2)
+	assert.Equal(t, "chat.send", desc.Methods[0].Name)
+	assert.True(t, desc.Methods[0].Deprecated)
+	assert.Equal(t, "Use chat.send@v2.", desc.Methods[0].DeprecationMessage)
+	assert.Equal(t, "2027-01-31", desc.Methods[0].Sunset)
+	assert.Equal(t, "v2", desc.Methods[1].Version)
+	assert.False(t, desc.Methods[1].Deprecated)
+	assert.Equal(t, sunset, r.Config().Methods["chat.send"].Deprecated.Sunset)
+}
+
+func TestAddProcedure_Audit(t *testing.T) {
+	t.Parallel()
+
+	type card struct {
+		Number string `json:"number" audit:"redact"`
+		Holder string
+	}
+	type meta struct {
+		Trace string `json:"trace" audit:"omit"`
+	}
+	type payParams struct {
+		meta
+		Amount int    `json:"amount"`
+		Token  string `json:"token" audit:"omit"`
+		Cards  []card `json:"cards"`
+	}
+
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "pay", api.Procedure[payParams, echoResult]{
+		Audit:   true,
+		Handler: func(context.Context, payParams) (echoResult, error) { return echoResult{}, nil },
+	}))
+	m := r.Config().Methods["pay"]
+	require.True(t, m.Audit)
+	require.NotNil(t, m.AuditParams)
+
+	got := m.AuditParams(json.RawMessage(`{"trace":"t1","amount":5,"token":"secret","cards":[{"number":"4111","Holder":"Ann"}]}`))
+	assert.Equal(t, map[string]any{
+		"amount": float64(5),
+		"cards":  []any{map[string]any{"number": "[REDACTED]", "Holder": "Ann"}},
+	}, got)
+	assert.Nil(t, m.AuditParams(json.RawMessage(`{"unknown":1}`)))
+
+	require.NoError(t, AddProcedure(r, "plain", api.Procedure[payParams, echoResult]{
+		Handler: func(context.Context, payParams) (echoResult, error) { return echoResult{}, nil },
+	}))
+	plain := r.Config().Methods["plain"]
+	assert.Nil(t, plain.AuditParams)
+	require.NotNil(t, plain.RedactParams, "recorded params are redacted for every procedure")
+	assert.Equal(t, map[string]any{"amount": float64(1), "cards": nil}, plain.RedactParams(json.RawMessage(`{"amount":1,"token":"secret"}`)))
+	assert.Equal(t, map[string]any{"amount": float64(2), "cards": nil}, plain.RedactResult(payParams{Amount: 2, Token: "secret"}))
+}
+
+func TestAddProcedure_InvalidAuditTag(t *testing.T) {
+	t.Parallel()
+
+	type badParams struct {
+		Name string `json:"name" audit:"hide"`
+	}
+	r := NewTypedRPCRouter()
+	err := AddProcedure(r, "bad", api.Procedure[badParams, echoResult]{
+		Audit:   true,
+		Handler: func(context.Context, badParams) (echoResult, error) { return echoResult{}, nil },
+	})
+	require.ErrorIs(t, err, api.ErrInvalid)
+	assert.Contains(t, err.Error(), `unknown audit tag "hide"`)
+}
+
+func TestDescribeTypedRPCRouter_Permissions(t *testing.T) {
+	t.Parallel()
+
+	r := NewTypedRPCRouter()
+	require.NoError(t, AddProcedure(r, "chat.delete", api.Procedure[echoParams, echoResult]{
+		Permissions: api.AllOf(api.Perm("Chat.Write"), api.Not(api.Perm("Chat.Banned"))),
+		Handler:     echoHandler,
+	}))
+	require.NoError(t, AddProcedure(r, "chat.list", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+	assert.NotNil(t, r.Config().Methods["chat.delete"].Permissions)
+
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	require.Len(t, desc.Methods, 2)
+	assert.Equal(t, &api.PermissionDescription{Op: "allOf", Args: []api.PermissionDescription{
+		{Op: "perm", Name: "Chat.Write"},
+		{Op: "not", Args: []api.PermissionDescription{{Op: "perm", Name: "Chat.Banned"}}},
+	}}, desc.Methods[0].Permissions)
+	assert.Nil(t, desc.Methods[1].Permissions)
+	assert.Equal(t, "allOf(Chat.Write, not(Chat.Banned))", r.Config().Methods["chat.delete"].Permissions.String())
+}
+
+type quotaDetails struct {
+	Limit int `json:"limit"`
+}
+
+func TestRegisterErrorCode(t *testing.T) {
+	t.Parallel()
+
+	r := NewTypedRPCRouter()
+	quota, err := RegisterErrorCode[quotaDetails](r, "quota_exceeded", "Quota exceeded.")
+	require.NoError(t, err)
+	_, err = RegisterErrorCode[struct{}](r, "conversation_locked", "Conversation is locked.")
+	require.NoError(t, err)
+
+	for _, code := range []string{"quota_exceeded", "not_found", "Bad-Code", ""} {
+		_, err := RegisterErrorCode[struct{}](r, code, "msg")
+		require.ErrorIs(t, err, api.ErrInvalid, code)
+	}
+
+	require.NoError(t, AddProcedure(r, "chat.send", api.Procedure[echoParams, echoResult]{
+		Errors: []string{"quota_exceeded", "conversation_locked", "not_found", "quota_exceeded"},
+		Handler: func(context.Context, echoParams) (echoResult, error) {
+			return echoResult{}, quota.New(quotaDetails{Limit: 10})
+		},
+	}))
+	err = AddProcedure(r, "chat.edit", api.Procedure[echoParams, echoResult]{
+		Errors:  []string{"message_too_old"},
+		Handler: echoHandler,
+	})
+	require.ErrorIs(t, err, api.ErrInvalid)
+	assert.Contains(t, err.Error(), `unknown error code "message_too_old"`)
+
+	assert.Equal(t, []string{"quota_exceeded", "conversation_locked"}, r.Config().ErrorCodes)
+
+	_, err = r.Config().Methods["chat.send"].Handler(context.Background(), json.RawMessage(`{"msg":"hi"}`))
+	var coded *api.CodedError
+	require.ErrorAs(t, err, &coded)
+	assert.Equal(t, "quota_exceeded", coded.Code)
+	assert.Equal(t, quotaDetails{Limit: 10}, coded.Details)
+
+	desc, err := DescribeTypedRPCRouter(r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"quota_exceeded", "conversation_locked", "not_found"}, desc.Methods[0].Errors)
+	assert.Equal(t, []api.TypedErrorDescription{
+		{Code: "conversation_locked", Message: "Conversation is locked."},
+		{Code: "quota_exceeded", Message: "Quota exceeded.", Details: &api.TypeRef{Kind: "named", Name: "quotaDetails"}},
+	}, desc.Errors)
+	assert.Contains(t, desc.Types, "quotaDetails")
+}
+
+func TestTypedRPCRouter_Mount(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	record := func(tag string) api.RPCInterceptor {
+		return func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+			calls = append(calls, tag+":"+method)
+			return next(ctx, params)
+		}
+	}
+
+	messages := NewTypedRPCRouter()
+	messages.Use(record("messages"))
+	messages.UsePermissions(api.Perm("Chat.Write"))
+	require.NoError(t, AddProcedure(messages, "send@v2", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+
+	chat := NewTypedRPCRouter()
+	chat.Use(record("chat"))
+	_, err := RegisterErrorCode[struct{}](chat, "conversation_locked", "Conversation is locked.")
+	require.NoError(t, err)
+	require.NoError(t, AddProcedure(chat, "list", api.Procedure[echoParams, echoResult]{
+		Permissions: api.Perm("Chat.Read"),
+		Errors:      []string{"conversation_locked"},
+		Handler:     echoHandler,
+	}))
+	require.NoError(t, chat.Mount("messages", messages))
+
+	root := NewTypedRPCRouter()
+	root.Use(record("root"))
+	root.UsePermissions(api.Perm("Chat.Access"))
+	require.NoError(t, root.Mount("chat", chat))
+
+	cfg := root.Config()
+	require.Len(t, cfg.Methods, 2)
+	send := cfg.Methods["chat.messages.send@v2"]
+	require.NotNil(t, send.Handler)
+	_, err = send.Handler(context.Background(), json.RawMessage(`{"msg":"hi"}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root:chat.messages.send@v2", "chat:chat.messages.send@v2", "messages:chat.messages.send@v2"}, calls)
+	assert.Equal(t, "allOf(Chat.Access, Chat.Write)", send.Permissions.String())
+	assert.Equal(t, "allOf(Chat.Access, Chat.Read)", cfg.Methods["chat.list"].Permissions.String())
+
+	desc, err := DescribeTypedRPCRouter(root)
+	require.NoError(t, err)
+	require.Len(t, desc.Methods, 2)
+	assert.Equal(t, "chat.list", desc.Methods[0].Name)
+	assert.Equal(t, "chat.messages.send@v2", desc.Methods[1].Name)
+	assert.Equal(t, "v2", desc.Methods[1].Version)
+	require.Len(t, desc.Errors, 1)
+	assert.Equal(t, "conversation_locked", desc.Errors[0].Code)
+
+	t.Run("Conflicts", func(t *testing.T) {
+		t.Parallel()
+
+		other := NewTypedRPCRouter()
+		require.NoError(t, AddProcedure(other, "list", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+		parent := NewTypedRPCRouter()
+		require.NoError(t, AddProcedure(parent, "chat.list", api.Procedure[echoParams, echoResult]{Handler: echoHandler}))
+		require.ErrorIs(t, parent.Mount("chat", other), api.ErrInvalid)
+		for _, prefix := range []string{"", "chat.", "a b", "chat@v2"} {
+			require.ErrorIs(t, parent.Mount(prefix, other), api.ErrInvalid, prefix)
+		}
+		require.ErrorIs(t, parent.Mount("self", parent), api.ErrInvalid)
+	})
+}
+
+type callerUserKey struct{}
+
+type callerUser struct {
+	permissions []string
+}
+
+func (u *callerUser) ID() uint                  { return 1 }
+func (u *callerUser) DisplayName() string       { return "caller" }
+func (u *callerUser) PermissionNames() []string { return u.permissions }
+
+func (u *callerUser) HasPermission(name string) bool {
+	for _, p := range u.permissions {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+type callerHost struct{}
+
+func (callerHost) ExtractUser(ctx context.Context) (api.AppletUser, error) {
+	u, ok := ctx.Value(callerUserKey{}).(api.AppletUser)
+	if !ok {
+		return nil, errors.New("no user")
+	}
+	return u, nil
+}
+
+func (callerHost) ExtractTenantID(context.Context) (uuid.UUID, error) { return uuid.Nil, nil }
+func (callerHost) ExtractPool(context.Context) (*pgxpool.Pool, error) { return nil, nil }
+func (callerHost) ExtractPageLocale(context.Context) language.Tag     { return language.English }
+
+type callerApplet struct {
+	router *TypedRPCRouter
+}
+
+func (a callerApplet) Name() string     { return "chat" }
+func (a callerApplet) BasePath() string { return "/chat" }
+func (a callerApplet) Config() api.Config {
+	return api.Config{RPC: a.router.Config()}
+}
+
+func TestCaller(t *testing.T) {
+	t.Parallel()
+
+	var intercepted []string
+	r := NewTypedRPCRouter()
+	r.Use(func(ctx context.Context, method string, params any, next api.RPCNext) (any, error) {
+		intercepted = append(intercepted, method)
+		return next(ctx, params)
+	})
+	require.NoError(t, AddProcedure(r, "chat.echo", api.Procedure[echoParams, echoResult]{
+		RequirePermissions: []string{"chat.read"},
+		Handler:            echoHandler,
+	}))
+	require.NoError(t, AddProcedure(r, "chat.fail", api.Procedure[echoParams, echoResult]{
+		Handler: func(context.Context, echoParams) (echoResult, error) {
+			return echoResult{}, fmt.Errorf("fail: %w", api.ErrConflict)
+		},
+	}))
+	require.NoError(t, AddProcedure(r, "chat.panic", api.Procedure[echoParams, echoResult]{
+		Handler: func(context.Context, echoParams) (echoResult, error) { panic("boom") },
+	}))
+	require.NoError(t, AddProcedure(r, "chat.applet", api.Procedure[echoParams, echoResult]{
+		Handler: func(ctx context.Context, _ echoParams) (echoResult, error) {
+			applet, _ := api.AppletFrom(ctx)
+			return echoResult{Msg: applet}, nil
+		},
+	}))
+	reg := registry.New()
+	require.NoError(t, reg.Register(callerApplet{router: r}))
+	c := NewCaller(reg, callerHost{})
+	ctx := context.WithValue(context.Background(), callerUserKey{}, api.AppletUser(&callerUser{permissions: []string{"chat.read"}}))
+
+	res, err := CallApplet[echoParams, echoResult](ctx, c, "chat", "chat.echo", echoParams{Msg: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, echoResult{Msg: "hi"}, res)
+	assert.Equal(t, []string{"chat.echo"}, intercepted)
+
+	type otherResult struct {
+		Msg string `json:"msg"`
+	}
+	other, err := CallApplet[map[string]string, otherResult](ctx, c, "chat", "chat.echo", map[string]string{"msg": "converted"})
+	require.NoError(t, err)
+	assert.Equal(t, otherResult{Msg: "converted"}, other)
+
+	_, err = c.Call(context.Background(), "chat", "chat.echo", echoParams{})
+	require.ErrorIs(t, err, api.ErrPermissionDenied)
+	_, err = c.Call(context.WithValue(context.Background(), callerUserKey{}, api.AppletUser(&callerUser{})), "chat", "chat.echo", echoParams{})
+	require.ErrorIs(t, err, api.ErrPermissionDenied)
+
+	// The callee sees its own applet, not the caller's.
+	res, err = CallApplet[echoParams, echoResult](api.WithApplet(ctx, "finance"), c, "chat", "chat.applet", echoParams{})
+	require.NoError(t, err)
+	assert.Equal(t, echoResult{Msg: "chat"}, res)
+
+	_, err = c.Call(ctx, "chat", "chat.fail", echoParams{})
+	require.ErrorIs(t, err, api.ErrConflict)
+	_, err = c.Call(ctx, "chat", "chat.panic", echoParams{})
+	require.ErrorIs(t, err, api.ErrInternal)
+
+	_, err = c.Call(ctx, "finance", "chat.echo", echoParams{})
+	require.ErrorIs(t, err, api.ErrNotFound)
+	assert.ErrorContains(t, err, `applet "finance" is not registered`)
+	_, err = c.Call(ctx, "chat", "chat.missing", echoParams{})
+	require.ErrorIs(t, err, api.ErrNotFound)
+	assert.ErrorContains(t, err, `applet "chat" has no method "chat.missing"`)
+}
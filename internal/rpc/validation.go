@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// Params validation is declared with `validate` struct tags on procedure
+// params, e.g. `validate:"required,min=1,max=100"` or `validate:"oneof=asc desc"`.
+//
+//   - required: the value must be non-zero (non-empty for strings, slices and maps).
+//   - min=N, max=N: bounds the length of strings (in runes), slices and maps,
+//     or the value of numbers.
+//   - oneof=a b c: the value must be one of the space-separated options.
+//
+// A nil pointer that is not required skips its remaining rules. Nested
+// structs, pointers, slices and maps are validated recursively.
+
+type validationRule struct {
+	name  string
+	arg   string
+	num   float64
+	oneOf []string
+}
+
+func parseValidateTag(tag string) ([]validationRule, error) {
+	var rules []validationRule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		rule := validationRule{name: name, arg: arg}
+		switch name {
+		case "required":
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid number %q", name, arg)
+			}
+			rule.num = n
+		case "oneof":
+			rule.oneOf = strings.Fields(arg)
+			if len(rule.oneOf) == 0 {
+				return nil, fmt.Errorf("rule %q: no options", name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkValidationTags reports malformed `validate` tags on t and whether t
+// declares any rules at all.
+func checkValidationTags(t reflect.Type) (bool, error) {
+	return checkValidationTagsDepth(t, make(map[reflect.Type]bool), 0)
+}
+
+func checkValidationTagsDepth(t reflect.Type, seen map[reflect.Type]bool, depth int) (bool, error) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] || depth > maxDescribeDepth {
+		return false, nil
+	}
+	seen[t] = true
+	found := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			rules, err := parseValidateTag(tag)
+			if err != nil {
+				return false, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+			}
+			found = found || len(rules) > 0
+		}
+		nested, err := checkValidationTagsDepth(f.Type, seen, depth+1)
+		if err != nil {
+			return false, err
+		}
+		found = found || nested
+	}
+	return found, nil
+}
+
+// validateParams applies `validate` tags on v and returns an
+// *api.ValidationError listing every failing field.
+func validateParams(v any) error {
+	var fields []api.FieldError
+	validateValue(reflect.ValueOf(v), "", &fields, 0)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &api.ValidationError{Fields: fields}
+}
+
+func validateValue(v reflect.Value, path string, out *[]api.FieldError, depth int) {
+	if !v.IsValid() || depth > maxDescribeDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			validateValue(v.Elem(), path, out, depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), out, depth+1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key().Interface()), out, depth+1)
+		}
+	case reflect.Struct:
+		validateStruct(v, path, out, depth)
+	default:
+	}
+}
+
+func validateStruct(v reflect.Value, path string, out *[]api.FieldError, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous {
+			validateValue(fv, path, out, depth+1)
+			continue
+		}
+		jsonName, _, skip := parseJSONTag(f.Tag.Get("json"), f.Name)
+		if skip {
+			continue
+		}
+		fieldPath := jsonName
+		if path != "" {
+			fieldPath = path + "." + jsonName
+		}
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			// Tags are checked when the procedure is registered.
+			rules, _ := parseValidateTag(tag)
+			if !applyRules(fv, fieldPath, rules, out) {
+				continue
+			}
+		}
+		validateValue(fv, fieldPath, out, depth+1)
+	}
+}
+
+// applyRules checks rules against v and reports whether nested values should
+// still be validated.
+func applyRules(v reflect.Value, path string, rules []validationRule, out *[]api.FieldError) bool {
+	for _, rule := range rules {
+		if rule.name != "required" {
+			continue
+		}
+		if isEmptyValue(v) {
+			*out = append(*out, api.FieldError{Field: path, Rule: "required", Message: "is required"})
+			return false
+		}
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	for _, rule := range rules {
+		var msg string
+		switch rule.name {
+		case "min", "max":
+			msg = checkBound(v, rule)
+		case "oneof":
+			msg = checkOneOf(v, rule)
+		}
+		if msg != "" {
+			*out = append(*out, api.FieldError{Field: path, Rule: rule.name, Message: msg})
+		}
+	}
+	return true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func checkBound(v reflect.Value, rule validationRule) string {
+	var (
+		n    float64
+		unit string
+	)
+	switch v.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		return ""
+	}
+	if rule.name == "min" && n < rule.num {
+		if unit != "" {
+			return "must contain at least " + rule.arg + unit
+		}
+		return "must be at least " + rule.arg
+	}
+	if rule.name == "max" && n > rule.num {
+		if unit != "" {
+			return "must contain at most " + rule.arg + unit
+		}
+		return "must be at most " + rule.arg
+	}
+	return ""
+}
+
+func checkOneOf(v reflect.Value, rule validationRule) string {
+	var s string
+	switch v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(v.Uint(), 10)
+	default:
+		return ""
+	}
+	for _, opt := range rule.oneOf {
+		if s == opt {
+			return ""
+		}
+	}
+	return "must be one of: " + strings.Join(rule.oneOf, ", ")
+}
@@ -71,6 +71,8 @@ type StreamContextBuilder struct {
 	host          api.HostServices
 }
 
+var _ api.IdentityStreamContextBuilder = (*StreamContextBuilder)(nil)
+
 // NewStreamContextBuilder creates a new StreamContextBuilder.
 func NewStreamContextBuilder(
 	config api.Config,
@@ -88,13 +90,21 @@ func NewStreamContextBuilder(
 
 // Build builds a StreamContext.
 func (b *StreamContextBuilder) Build(ctx context.Context, r *http.Request) (*api.StreamContext, error) {
+	_, streamCtx, err := b.BuildContext(ctx, r)
+	return streamCtx, err
+}
+
+// BuildContext builds a StreamContext and returns ctx carrying the identity it
+// was built from. It implements api.IdentityStreamContextBuilder.
+func (b *StreamContextBuilder) BuildContext(ctx context.Context, r *http.Request) (context.Context, *api.StreamContext, error) {
 	const op = "StreamContextBuilder.Build"
 	start := time.Now()
 
 	id, err := appletctx.ExtractIdentity(ctx, b.host, op, b.logger)
 	if err != nil {
-		return nil, err
+		return ctx, nil, err
 	}
+	ctx = api.WithIdentity(ctx, id)
 
 	session := appletctx.BuildSessionContext(r, b.sessionConfig, nil) // no store for stream
 	streamCtx := &api.StreamContext{
@@ -119,5 +129,5 @@ func (b *StreamContextBuilder) Build(ctx context.Context, r *http.Request) (*api
 			"duration_ms": time.Since(start).Milliseconds(),
 		}).Debug("Built stream context")
 	}
-	return streamCtx, nil
+	return ctx, streamCtx, nil
 }
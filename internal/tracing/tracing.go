@@ -0,0 +1,44 @@
+// Package tracing starts spans through an optional api.Tracer.
+package tracing
+
+import (
+	"context"
+
+	"github.com/iota-uz/applets/internal/api"
+)
+
+// Attribute keys set on applet spans.
+const (
+	AttrApplet    = "applet.name"
+	AttrMethod    = "rpc.method"
+	AttrErrorCode = "rpc.error_code"
+)
+
+// WithApplet returns ctx carrying the applet name (see api.AppletFrom); spans
+// started from it get the AttrApplet attribute.
+func WithApplet(ctx context.Context, name string) context.Context {
+	return api.WithApplet(ctx, name)
+}
+
+// Start starts a span named name on tracer. With a nil tracer it returns ctx
+// unchanged and a span that does nothing.
+func Start(ctx context.Context, tracer api.Tracer, name string, attrs map[string]string) (context.Context, api.Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	if applet, ok := api.AppletFrom(ctx); ok {
+		merged := make(map[string]string, len(attrs)+1)
+		for k, v := range attrs {
+			merged[k] = v
+		}
+		merged[AttrApplet] = applet
+		attrs = merged
+	}
+	return tracer.Start(ctx, name, attrs)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, string) {}
+func (noopSpan) RecordError(error)           {}
+func (noopSpan) End()                        {}
@@ -13,3 +13,11 @@ func WithErrorEnricher(enricher ErrorContextEnricher) BuilderOption {
 func WithSessionStore(store SessionStore) BuilderOption {
 	return api.WithSessionStore(store)
 }
+
+func WithTracer(tracer Tracer) BuilderOption {
+	return api.WithTracer(tracer)
+}
+
+func WithAuditSink(sink AuditSink) BuilderOption {
+	return api.WithAuditSink(sink)
+}
@@ -0,0 +1,55 @@
+// Package rpcencoding provides optional payload encodings for the applet RPC
+// endpoint: a MessagePack codec and a brotli compressor. Register them on the
+// router next to the built-in JSON and gzip:
+//
+//	router.UseCodecs(rpcencoding.MsgPack())
+//	router.UseCompressors(rpcencoding.Brotli())
+//
+// They live outside the root package so applets that don't use them don't
+// link their dependencies.
+package rpcencoding
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/iota-uz/applets"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgPackContentType is the media type served by the MsgPack codec.
+const MsgPackContentType = "application/msgpack"
+
+type msgpackCodec struct{}
+
+// MsgPack returns a codec for "application/msgpack" payloads. Maps must have
+// string keys, as they become JSON objects.
+func MsgPack() applets.RPCCodec { return msgpackCodec{} }
+
+func (msgpackCodec) ContentType() string { return MsgPackContentType }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type brotliCompressor struct {
+	level int
+}
+
+// Brotli returns a compressor for the "br" content encoding at the default
+// quality.
+func Brotli() applets.RPCCompressor { return BrotliLevel(brotli.DefaultCompression) }
+
+// BrotliLevel returns a "br" compressor with the given quality, from
+// brotli.BestSpeed (0) to brotli.BestCompression (11).
+func BrotliLevel(level int) applets.RPCCompressor { return brotliCompressor{level: level} }
+
+func (brotliCompressor) Encoding() string { return "br" }
+
+func (c brotliCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriterLevel(w, c.level), nil
+}
+
+func (brotliCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
@@ -0,0 +1,66 @@
+package rpcencoding_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iota-uz/applets"
+	"github.com/iota-uz/applets/applettest"
+	"github.com/iota-uz/applets/rpcencoding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type echoParams struct {
+	Text string `json:"text"`
+}
+
+type echoResult struct {
+	Text  string `json:"text" msgpack:"text"`
+	Count int    `json:"count" msgpack:"count"`
+}
+
+func TestMsgPackAndBrotli(t *testing.T) {
+	t.Parallel()
+
+	r := applets.NewTypedRPCRouter()
+	r.UseCodecs(rpcencoding.MsgPack())
+	r.UseCompressors(rpcencoding.Brotli())
+	require.NoError(t, applets.AddProcedure(r, "echo", applets.Procedure[echoParams, echoResult]{
+		Handler: func(ctx context.Context, p echoParams) (echoResult, error) {
+			return echoResult{Text: p.Text, Count: len(p.Text)}, nil
+		},
+	}))
+	h := applettest.New(t, r, applettest.WithUser(applettest.NewUser(1)), applettest.WithRPCConfig(func(cfg *applets.RPCConfig) {
+		cfg.CompressionThreshold = 1
+	}))
+
+	body, err := msgpack.Marshal(map[string]any{"id": "1", "method": "echo", "params": map[string]any{"text": "hello"}})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(body))
+	req.Header.Set("Content-Type", rpcencoding.MsgPackContentType)
+	req.Header.Set("Accept", rpcencoding.MsgPackContentType)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, rpcencoding.MsgPackContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	zr, err := rpcencoding.Brotli().NewReader(w.Body)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	var resp struct {
+		ID     string     `msgpack:"id"`
+		Result echoResult `msgpack:"result"`
+	}
+	require.NoError(t, msgpack.Unmarshal(raw, &resp))
+	assert.Equal(t, "1", resp.ID)
+	assert.Equal(t, echoResult{Text: "hello", Count: 5}, resp.Result)
+}
@@ -7,18 +7,23 @@ import (
 )
 
 type (
-	Applet          = api.Applet
-	ShellMode       = api.ShellMode
-	ShellConfig     = api.ShellConfig
-	Config          = api.Config
-	LayoutFactory   = api.LayoutFactory
-	MountConfig     = api.MountConfig
-	EndpointConfig  = api.EndpointConfig
-	AssetConfig     = api.AssetConfig
-	DevAssetConfig  = api.DevAssetConfig
-	RPCConfig       = api.RPCConfig
-	RPCMethod       = api.RPCMethod
-	ContextExtender = api.ContextExtender
+	Applet                 = api.Applet
+	ShellMode              = api.ShellMode
+	ShellConfig            = api.ShellConfig
+	Config                 = api.Config
+	LayoutFactory          = api.LayoutFactory
+	MountConfig            = api.MountConfig
+	EndpointConfig         = api.EndpointConfig
+	AssetConfig            = api.AssetConfig
+	DevAssetConfig         = api.DevAssetConfig
+	RPCConfig              = api.RPCConfig
+	RPCMethod              = api.RPCMethod
+	RPCWebSocketConfig     = api.RPCWebSocketConfig
+	RPCConnection          = api.RPCConnection
+	RPCIntrospectionConfig = api.RPCIntrospectionConfig
+	RPCCodec               = api.RPCCodec
+	RPCCompressor          = api.RPCCompressor
+	ContextExtender        = api.ContextExtender
 )
 
 type (
@@ -43,18 +48,42 @@ type (
 type (
 	ErrorContextEnricher = api.ErrorContextEnricher
 	MetricsRecorder      = api.MetricsRecorder
+	ValueRecorder        = api.ValueRecorder
 	SessionStore         = api.SessionStore
 	HostServices         = api.HostServices
 	TenantNameResolver   = api.TenantNameResolver
 	BuilderOption        = api.BuilderOption
+	Tracer               = api.Tracer
+	Span                 = api.Span
+	AuditSink            = api.AuditSink
+	AuditEvent           = api.AuditEvent
+	RPCRecorder          = api.RPCRecorder
+	RPCReplayer          = api.RPCReplayer
+	RPCRecord            = api.RPCRecord
+	RPCRecordError       = api.RPCRecordError
+)
+
+type (
+	RateLimiter       = api.RateLimiter
+	RateLimitKey      = api.RateLimitKey
+	RateLimitDecision = api.RateLimitDecision
+	IdempotencyStore  = api.IdempotencyStore
+	IdempotencyStatus = api.IdempotencyStatus
 )
 
 type (
 	AppletUser     = api.AppletUser
+	Identity       = api.Identity
 	DetailedUser   = api.DetailedUser
 	ContextBuilder = api.ContextBuilder
 )
 
+type (
+	PermissionExpr        = api.PermissionExpr
+	PermissionFunc        = api.PermissionFunc
+	PermissionDescription = api.PermissionDescription
+)
+
 type (
 	ViteManifest      = api.ViteManifest
 	ViteManifestEntry = api.ViteManifestEntry
@@ -67,19 +96,39 @@ type (
 )
 
 type (
-	Procedure[P any, R any] = api.Procedure[P, R]
-	TypedRPCRouter          = rpc.TypedRPCRouter
-	TypedRouterDescription  = api.TypedRouterDescription
-	TypedMethodDescription  = api.TypedMethodDescription
-	TypedTypeObject         = api.TypedTypeObject
-	TypedField              = api.TypedField
-	TypeRef                 = api.TypeRef
+	Procedure[P any, R any]       = api.Procedure[P, R]
+	StreamProcedure[P any, E any] = api.StreamProcedure[P, E]
+	StreamEmitter[E any]          = api.StreamEmitter[E]
+	UploadProcedure[P any, R any] = api.UploadProcedure[P, R]
+	UploadFiles                   = api.UploadFiles
+	UploadFile                    = api.UploadFile
+	Deprecation                   = api.Deprecation
+	ErrorCode[D any]              = api.ErrorCode[D]
+	CodedError                    = api.CodedError
+	RPCInterceptor                = api.RPCInterceptor
+	RPCNext                       = api.RPCNext
+	TypedRPCRouter                = rpc.TypedRPCRouter
+	AppletCaller                  = rpc.Caller
+	TypedRouterDescription        = api.TypedRouterDescription
+	TypedMethodDescription        = api.TypedMethodDescription
+	TypedUploadDescription        = api.TypedUploadDescription
+	TypedEncodings                = api.TypedEncodings
+	TypedErrorDescription         = api.TypedErrorDescription
+	TypedTypeObject               = api.TypedTypeObject
+	TypedField                    = api.TypedField
+	TypeRef                       = api.TypeRef
 )
 
 type (
-	Registry             = api.Registry
-	StreamWriter         = api.StreamWriter
-	StreamContextBuilder = api.StreamContextBuilder
+	ValidationError = api.ValidationError
+	FieldError      = api.FieldError
+)
+
+type (
+	Registry                     = api.Registry
+	StreamWriter                 = api.StreamWriter
+	StreamContextBuilder         = api.StreamContextBuilder
+	IdentityStreamContextBuilder = api.IdentityStreamContextBuilder
 )
 
 const (
@@ -87,6 +136,12 @@ const (
 	ShellModeStandalone = api.ShellModeStandalone
 )
 
+const (
+	IdempotencyNew       = api.IdempotencyNew
+	IdempotencyInFlight  = api.IdempotencyInFlight
+	IdempotencyCompleted = api.IdempotencyCompleted
+)
+
 const (
 	TranslationModeAll      = api.TranslationModeAll
 	TranslationModePrefixes = api.TranslationModePrefixes
@@ -99,5 +154,8 @@ var (
 	ErrNotFound          = api.ErrNotFound
 	ErrPermissionDenied  = api.ErrPermissionDenied
 	ErrInternal          = api.ErrInternal
+	ErrRateLimited       = api.ErrRateLimited
+	ErrConflict          = api.ErrConflict
+	ErrPayloadTooLarge   = api.ErrPayloadTooLarge
 	DefaultSessionConfig = api.DefaultSessionConfig
 )
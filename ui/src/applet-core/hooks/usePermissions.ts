@@ -1,5 +1,7 @@
 import { useAppletContext } from '../context/AppletContext';
-import type { PermissionsHook } from '../types';
+import type { PermissionExpr, PermissionsHook } from '../types';
+
+type PermissionVerdict = 'allow' | 'deny' | 'unknown'
 
 /**
  * usePermissions provides permission checking utilities.
@@ -15,6 +17,10 @@ import type { PermissionsHook } from '../types';
  * if (hasAnyPermission('finance.view', 'finance.edit')) {
  *   // User has at least one of these permissions
  * }
+ *
+ * if (satisfies(ChatRPCPermissions['chat.delete'])) {
+ *   // Show the delete action
+ * }
  */
 export function usePermissions(): PermissionsHook {
   const { user } = useAppletContext();
@@ -27,9 +33,46 @@ export function usePermissions(): PermissionsHook {
     return permissions.some(p => user.permissions.includes(p));
   };
 
+  // "func" nodes can only be decided by the server, so expressions are
+  // evaluated with three values: a node that depends on one is "unknown"
+  // unless the rest of the expression decides it. Unknown is shown as allowed;
+  // the server still rejects calls the user can't make.
+  const evaluate = (expr: PermissionExpr): PermissionVerdict => {
+    const args = expr.args ?? [];
+    switch (expr.op) {
+      case 'perm':
+        return expr.name !== undefined && user.permissions.includes(expr.name) ? 'allow' : 'deny';
+      case 'allOf': {
+        const verdicts = args.map(evaluate);
+        if (verdicts.includes('deny')) {return 'deny';}
+        return verdicts.includes('unknown') ? 'unknown' : 'allow';
+      }
+      case 'anyOf': {
+        const verdicts = args.map(evaluate);
+        if (verdicts.includes('allow')) {return 'allow';}
+        return verdicts.includes('unknown') ? 'unknown' : 'deny';
+      }
+      case 'not': {
+        if (args.length === 0) {return 'deny';}
+        const verdict = evaluate(args[0]);
+        if (verdict === 'unknown') {return 'unknown';}
+        return verdict === 'allow' ? 'deny' : 'allow';
+      }
+      case 'func':
+        return 'unknown';
+      default:
+        return 'deny';
+    }
+  };
+
+  const satisfies = (expr: PermissionExpr | undefined): boolean => {
+    return !expr || evaluate(expr) !== 'deny';
+  };
+
   return {
     hasPermission,
     hasAnyPermission,
+    satisfies,
     permissions: user.permissions
   };
 }
@@ -31,6 +31,7 @@ export type {
   SessionContext,
   TranslationHook,
   PermissionsHook,
+  PermissionExpr,
   SessionHook,
   StreamingHook
 } from './types';
@@ -75,9 +75,20 @@ export interface TranslationHook {
   language: string
 }
 
+/**
+ * Permission expression of an RPC method, as emitted in `<T>Permissions` by
+ * `applet rpc gen`. "func" nodes are custom server-side predicates.
+ */
+export interface PermissionExpr {
+  readonly op: 'perm' | 'allOf' | 'anyOf' | 'not' | 'func'
+  readonly name?: string
+  readonly args?: readonly PermissionExpr[]
+}
+
 export interface PermissionsHook {
   hasPermission: (permission: string) => boolean
   hasAnyPermission: (...permissions: string[]) => boolean
+  satisfies: (expr: PermissionExpr | undefined) => boolean
   permissions: string[]
 }
 
@@ -22,6 +22,22 @@ export class AppletRPCException extends Error {
 
 export type AppletRPCSchema = Record<string, { params: unknown; result: unknown }>
 
+// UploadMethod is a method of TRouter generated with a files field.
+type UploadMethod<TRouter extends AppletRPCSchema> = {
+  [K in keyof TRouter & string]: TRouter[K] extends { files: unknown } ? K : never
+}[keyof TRouter & string]
+
+// StreamMethod is a method of TRouter generated with stream: true.
+type StreamMethod<TRouter extends AppletRPCSchema> = {
+  [K in keyof TRouter & string]: TRouter[K] extends { stream: true } ? K : never
+}[keyof TRouter & string]
+
+// CallMethod is a method of TRouter that answers with a single result.
+type CallMethod<TRouter extends AppletRPCSchema> = Exclude<keyof TRouter & string, StreamMethod<TRouter>>
+
+// StreamEvent is the event type of a streaming method's AsyncIterable result.
+type StreamEvent<TResult> = TResult extends AsyncIterable<infer E> ? E : never
+
 interface RPCRequest {
   id: string
   method: string
@@ -38,13 +54,27 @@ export interface CreateAppletRPCClientOptions {
   endpoint: string
   fetcher?: typeof fetch
   timeoutMs?: number
+  // Query methods are called with GET so browser and CDN caches can serve them
+  // (pass the generated <Router>QueryMethods).
+  queryMethods?: readonly string[]
 }
 
 export function createAppletRPCClient(options: CreateAppletRPCClientOptions) {
   const fetcher = options.fetcher ?? fetch;
   const timeoutMs = typeof options.timeoutMs === 'number' && options.timeoutMs > 0 ? options.timeoutMs : 0;
+  const queryMethods = new Set(options.queryMethods ?? []);
 
   async function call<TParams, TResult>(method: string, params: TParams): Promise<TResult> {
+    return send<TResult>(method, params);
+  }
+
+  // upload calls an upload procedure: the request is the first part of a
+  // multipart body and every file follows as a part of its own.
+  async function upload<TParams, TResult>(method: string, params: TParams, files: ReadonlyArray<File | Blob>): Promise<TResult> {
+    return send<TResult>(method, params, files);
+  }
+
+  async function send<TResult>(method: string, params: unknown, files?: ReadonlyArray<File | Blob>): Promise<TResult> {
     const req: RPCRequest = { id: crypto.randomUUID(), method, params };
     const startedAt = typeof performance !== 'undefined' ? performance.now() : Date.now();
     const abortController = timeoutMs > 0 ? new AbortController() : undefined;
@@ -64,12 +94,26 @@ export function createAppletRPCClient(options: CreateAppletRPCClientOptions) {
         }, timeoutMs);
       }
 
-      const resp = await fetcher(options.endpoint, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(req),
-        signal: abortController?.signal,
-      });
+      let resp: Response;
+      if (files) {
+        resp = await fetcher(options.endpoint, {
+          method: 'POST',
+          body: uploadBody(req, files),
+          signal: abortController?.signal,
+        });
+      } else if (queryMethods.has(method)) {
+        resp = await fetcher(queryURL(options.endpoint, method, params), {
+          method: 'GET',
+          signal: abortController?.signal,
+        });
+      } else {
+        resp = await fetcher(options.endpoint, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify(req),
+          signal: abortController?.signal,
+        });
+      }
 
       if (!resp.ok) {
         throw new AppletRPCException({
@@ -127,14 +171,119 @@ export function createAppletRPCClient(options: CreateAppletRPCClientOptions) {
     }
   }
 
+  // stream calls a streaming procedure. The server answers with server-sent
+  // events: every "result" event is yielded, an "error" event is thrown and
+  // "done" ends the iteration. Leaving the loop early aborts the request.
+  // Streams are not bounded by timeoutMs.
+  function stream<TParams, TEvent>(method: string, params: TParams): AsyncIterable<TEvent> {
+    return {
+      [Symbol.asyncIterator]: () => streamEvents<TEvent>(method, params),
+    };
+  }
+
+  async function* streamEvents<TEvent>(method: string, params: unknown): AsyncGenerator<TEvent, void, undefined> {
+    const req: RPCRequest = { id: crypto.randomUUID(), method, params };
+    const startedAt = typeof performance !== 'undefined' ? performance.now() : Date.now();
+    const abortController = new AbortController();
+    maybeDispatchRPCEvent({
+      id: req.id,
+      method: req.method,
+      status: 'start',
+    });
+
+    try {
+      const resp = await fetcher(options.endpoint, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', Accept: 'text/event-stream, application/json' },
+        body: JSON.stringify(req),
+        signal: abortController.signal,
+      });
+
+      if (!resp.ok) {
+        throw new AppletRPCException({
+          code: 'http_error',
+          message: `HTTP ${resp.status}`,
+          details: { status: resp.status },
+        });
+      }
+
+      // Failures before the stream starts (permissions, rate limits) are
+      // answered as a regular JSON response.
+      if (!(resp.headers.get('Content-Type') ?? '').startsWith('text/event-stream')) {
+        const json = (await resp.json()) as RPCResponse<unknown>;
+        throw new AppletRPCException(json.error ?? {
+          code: 'invalid_response',
+          message: 'Expected an event stream',
+        });
+      }
+      if (!resp.body) {
+        throw new AppletRPCException({
+          code: 'invalid_response',
+          message: 'Missing event stream body',
+        });
+      }
+
+      for await (const ev of readServerSentEvents(resp.body)) {
+        if (ev.event === 'result') {
+          yield JSON.parse(ev.data) as TEvent;
+        } else if (ev.event === 'error') {
+          const rpcErr = JSON.parse(ev.data) as AppletRPCError;
+          throw new AppletRPCException({
+            code: rpcErr.code,
+            message: rpcErr.message,
+            details: rpcErr.details,
+          });
+        } else if (ev.event === 'done') {
+          maybeDispatchRPCEvent({
+            id: req.id,
+            method: req.method,
+            status: 'success',
+            durationMs: elapsedMs(startedAt),
+          });
+          return;
+        }
+      }
+
+      throw new AppletRPCException({
+        code: 'invalid_response',
+        message: 'Event stream ended without a done event',
+      });
+    } catch (err) {
+      maybeDispatchRPCEvent({
+        id: req.id,
+        method: req.method,
+        status: 'error',
+        durationMs: elapsedMs(startedAt),
+        error: err,
+      });
+      throw err;
+    } finally {
+      abortController.abort();
+    }
+  }
+
   async function callTyped<
     TRouter extends AppletRPCSchema,
-    TMethod extends keyof TRouter & string,
+    TMethod extends CallMethod<TRouter>,
   >(method: TMethod, params: TRouter[TMethod]['params']): Promise<TRouter[TMethod]['result']> {
     return call(method, params) as Promise<TRouter[TMethod]['result']>;
   }
 
-  return { call, callTyped };
+  async function uploadTyped<
+    TRouter extends AppletRPCSchema,
+    TMethod extends UploadMethod<TRouter>,
+  >(method: TMethod, params: TRouter[TMethod]['params'], files: ReadonlyArray<File | Blob>): Promise<TRouter[TMethod]['result']> {
+    return upload(method, params, files) as Promise<TRouter[TMethod]['result']>;
+  }
+
+  function streamTyped<
+    TRouter extends AppletRPCSchema,
+    TMethod extends StreamMethod<TRouter>,
+  >(method: TMethod, params: TRouter[TMethod]['params']): AsyncIterable<StreamEvent<TRouter[TMethod]['result']>> {
+    return stream(method, params);
+  }
+
+  return { call, callTyped, upload, uploadTyped, stream, streamTyped };
 }
 
 type RPCDevEvent = {
@@ -153,6 +302,70 @@ function maybeDispatchRPCEvent(detail: RPCDevEvent) {
   window.dispatchEvent(new CustomEvent('iota:applet-rpc', { detail }));
 }
 
+// queryURL builds a GET URL without a request id, so identical calls share a cache entry.
+function queryURL(endpoint: string, method: string, params: unknown): string {
+  const search = new URLSearchParams({ method });
+  if (params !== undefined) {
+    search.set('params', JSON.stringify(params));
+  }
+  return endpoint + (endpoint.includes('?') ? '&' : '?') + search.toString();
+}
+
+function uploadBody(req: RPCRequest, files: ReadonlyArray<File | Blob>): FormData {
+  const form = new FormData();
+  form.append('request', JSON.stringify(req));
+  for (const file of files) {
+    form.append('file', file, file instanceof File ? file.name : 'blob');
+  }
+  return form;
+}
+
+interface ServerSentEvent {
+  event: string
+  data: string
+}
+
+// readServerSentEvents parses a text/event-stream body into its events.
+// Comments and fields other than event and data are ignored.
+async function* readServerSentEvents(body: ReadableStream<Uint8Array>): AsyncGenerator<ServerSentEvent, void, undefined> {
+  const reader = body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = '';
+  let event = 'message';
+  let data: string[] = [];
+  try {
+    for (;;) {
+      const { done, value } = await reader.read();
+      buffer += done ? decoder.decode() : decoder.decode(value, { stream: true });
+      let newline: number;
+      while ((newline = buffer.indexOf('\n')) >= 0) {
+        const line = buffer.slice(0, newline).replace(/\r$/, '');
+        buffer = buffer.slice(newline + 1);
+        if (line === '') {
+          if (data.length > 0) {
+            yield { event, data: data.join('\n') };
+          }
+          event = 'message';
+          data = [];
+          continue;
+        }
+        const colon = line.indexOf(':');
+        if (colon === 0) {continue;}
+        const field = colon < 0 ? line : line.slice(0, colon);
+        const fieldValue = colon < 0 ? '' : line.slice(colon + 1).replace(/^ /, '');
+        if (field === 'event') {
+          event = fieldValue;
+        } else if (field === 'data') {
+          data.push(fieldValue);
+        }
+      }
+      if (done) {return;}
+    }
+  } finally {
+    reader.releaseLock();
+  }
+}
+
 function elapsedMs(startedAt: number): number {
   const now = typeof performance !== 'undefined' ? performance.now() : Date.now();
   return Math.max(0, Math.round(now - startedAt));